@@ -0,0 +1,150 @@
+package main
+
+import (
+	"image/color"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/galsjel/go-playground/grid"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	// agent_window is how many steps ahead the agents plan around each other. they replan halfway through.
+	agent_window = 16
+
+	// max_agents keeps the number of agents within what can be planned every few ticks.
+	max_agents = 32
+)
+
+type agent struct {
+	pos  grid.Vec2i
+	goal grid.Vec2i
+	size int
+	// plan is where the agent will be at every step from now on. it starts with the current position.
+	plan []grid.Vec2i
+}
+
+// add_agent spawns an agent of the given size at a random free cell, heading to another random cell.
+func (g *distance_field) add_agent(size int) bool {
+	random_cell := func(taken func(agent) grid.Vec2i) (grid.Vec2i, bool) {
+	next:
+		for tries := 0; tries < 1000; tries++ {
+			p := grid.Vec2i{X: rand.IntN(g.grid.Width()), Y: rand.IntN(g.grid.Height())}
+			if !g.grid.AtPos(p).Traversable(size) {
+				continue
+			}
+			for _, other := range g.agents {
+				reach := size + other.size - 1
+				if p.DistanceSq(taken(other)) < reach*reach {
+					continue next
+				}
+			}
+			return p, true
+		}
+		return grid.Vec2i{}, false
+	}
+
+	start, ok := random_cell(func(a agent) grid.Vec2i { return a.pos })
+	if !ok {
+		return false
+	}
+	goal, ok := random_cell(func(a agent) grid.Vec2i { return a.goal })
+	if !ok {
+		return false
+	}
+	g.agents = append(g.agents, agent{pos: start, goal: goal, size: size})
+	g.agents_dirty = true
+	return true
+}
+
+func (g *distance_field) remove_agent(i int) {
+	g.agents = append(g.agents[:i], g.agents[i+1:]...)
+	if g.selected == i {
+		g.selected = -1
+	} else if g.selected > i {
+		g.selected--
+	}
+	g.agents_dirty = true
+}
+
+// plan_agents requests new plans for every agent around each other, in the order they were added. they arrive on a
+// later tick, and the agents wait for them. each agent has its own request, but they're planned together by whichever
+// of them runs first.
+func (g *distance_field) plan_agents() {
+	g.sync_snapshot()
+	g.agents_dirty = false
+	g.agent_steps = 0
+	group := &agent_group{snapshot: g.snapshot, agents: make([]grid.Agent, len(g.agents))}
+	for i, a := range g.agents {
+		group.agents[i] = grid.Agent{Start: a.pos, Goal: a.goal, Size: a.size}
+	}
+	for i, a := range g.agents {
+		args := grid.PathArgs{Start: a.pos, Goal: a.goal, MinSpace: a.size}
+		g.paths.Request(grid.PathRequest{ID: agent_request + i, Args: args, Search: func(arg grid.PathArgs) grid.PathResult {
+			g.snapshot_mu.RLock()
+			defer g.snapshot_mu.RUnlock()
+			return group.plan(arg, i)
+		}})
+	}
+	for i := len(g.agents); i < max_agents; i++ {
+		g.paths.Cancel(agent_request + i)
+	}
+}
+
+// agents_planning reports whether any agent is still waiting for its plan.
+func (g *distance_field) agents_planning() bool {
+	for i := range g.agents {
+		if g.paths.Pending(agent_request + i) {
+			return true
+		}
+	}
+	return false
+}
+
+// agent_group is the agents planned by one call to plan_agents.
+type agent_group struct {
+	once     sync.Once
+	snapshot *grid.Grid
+	agents   []grid.Agent
+	paths    [][]grid.Vec2i
+}
+
+// plan answers the request of agent i. the first request to run plans the whole group, and the others wait for it.
+// the group's requests are only ever cancelled together, so it doesn't matter whose context stops the planning.
+func (a *agent_group) plan(arg grid.PathArgs, i int) grid.PathResult {
+	a.once.Do(func() {
+		a.paths = a.snapshot.PlanAgentsContext(arg.Context, a.agents, agent_window)
+	})
+	if a.paths == nil {
+		return grid.PathResult{Status: grid.PathCancelled}
+	}
+	return grid.PathResult{Path: a.paths[i], Status: grid.PathFound}
+}
+
+// step_agents moves every agent one step along its plan.
+func (g *distance_field) step_agents() {
+	for i := range g.agents {
+		a := &g.agents[i]
+		if len(a.plan) > 1 {
+			a.plan = a.plan[1:]
+			a.pos = a.plan[0]
+		}
+	}
+	g.agent_steps++
+	if g.agent_steps >= agent_window/2 {
+		g.agents_dirty = true
+	}
+}
+
+// draw_agent draws a dot on pos with a ring around the cells an agent of the given size takes up.
+func (g *distance_field) draw_agent(screen *ebiten.Image, pos grid.Vec2i, size float64, clr color.RGBA) {
+	x, y := g.cell_center(pos)
+	radius := float32((1 + 2*(size-1)) * float64(g.cell_size) * 0.5)
+	dot := max(float32(g.cell_size)*0.5, 1)
+	vector.DrawFilledCircle(screen, x+1, y+1, dot, color.RGBA{0, 0, 0, 64}, false)
+	vector.DrawFilledCircle(screen, x, y, dot, clr, false)
+	vector.StrokeCircle(screen, x+1, y+1, radius, 1, color.RGBA{0, 0, 0, 64}, false)
+	vector.StrokeCircle(screen, x, y, radius, 1, clr, false)
+}
@@ -2,402 +2,635 @@ package main
 
 import (
 	"bytes"
-	"encoding/gob"
+	"errors"
 	"fmt"
+	"image"
 	"image/color"
-	"log"
+	"image/png"
 	"math"
+	"math/rand/v2"
 	"os"
-	"slices"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/ebitengine/debugui"
+	"github.com/galsjel/go-playground/grid"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 )
 
 const (
-	tile_size    = 8
-	tile_size_px = cell_size * tile_size
+	// tile_size is fixed by the map format, unlike the size of the grid.
+	tile_size = grid.TileSize
 
-	grid_tile_divisions = grid_size / tile_size
-
-	grid_size    = 128
 	grid_size_px = min(game_width, game_height)
 
-	cell_size = grid_size_px / grid_size
+	// default_grid_size and default_max_distance are used unless the command line says otherwise.
+	default_grid_size    = 128
+	default_max_distance = 15
+
+	// max_grid_size keeps the canvas within what fits in a texture. larger grids are drawn at a pixel per cell and scaled
+	// down to the viewport.
+	max_grid_size = 1024
+	// max_max_distance is how far the clearance cap can be raised from the menu.
+	max_max_distance = 64
+
+	// wall_brush is the brush that toggles cells open and closed instead of painting a terrain.
+	wall_brush = grid.TerrainCount
+
+	// cave_fill, cave_steps and min_room shape the generated maps where the menu doesn't.
+	cave_fill  = 0.45
+	cave_steps = 4
+	min_room   = 5
 
-	max_distance = 15
+	// move_delay is how many ticks the player waits between steps along a road.
+	move_delay = 3
+
+	// player_request is the id of the player's path requests.
+	player_request = 0
+	// agent_request is the id of the first agent's plan requests. the agent at index i uses agent_request + i.
+	agent_request = 1
+
+	// path_workers is how many path requests can be searched at once.
+	path_workers = 2
 )
 
-type cell struct {
-	// closed describes whether this cell is traversable or not. closed means it blocks traversal.
-	closed bool
-	// space is a weight used to determine the space of the closest closed cell.
-	space int
-	// _input_cycle is only for user input handling.
-	_input_cycle int
-}
+type search_mode int
 
-type tile struct {
-	cells *[64]cell
-}
+const (
+	search_astar search_mode = iota
+	search_jps
+	search_hierarchy
+	search_mode_count
+)
 
-type chunk struct {
-	tiles *[64]tile
+// id is what the scene saves the search as, which stays the same when the label changes.
+func (m search_mode) id() string {
+	switch m {
+	case search_astar:
+		return grid.SearchAStar
+	case search_jps:
+		return grid.SearchJPS
+	case search_hierarchy:
+		return grid.SearchHierarchy
+	default:
+		return ""
+	}
 }
 
-func (c *cell) traversable(min_space int) bool {
-	if c == nil {
-		return false
+func (m search_mode) String() string {
+	switch m {
+	case search_astar:
+		return "A*"
+	case search_jps:
+		return "Jump Point Search"
+	case search_hierarchy:
+		return "Hierarchical"
+	default:
+		return "?"
 	}
-	return !c.closed && c.space >= min_space
+}
+
+// terrain_colors are the colours of open cells, by terrain.
+var terrain_colors = [grid.TerrainCount]color.RGBA{
+	grid.TerrainRoad:  {127, 127, 127, 255},
+	grid.TerrainGrass: {96, 140, 72, 255},
+	grid.TerrainMud:   {112, 84, 56, 255},
+	grid.TerrainWater: {56, 96, 160, 255},
 }
 
 type distance_field struct {
 	cycle      int
 	move_timer int
 	drag_cycle int
-	cells      []cell
+	grid       *grid.Grid
+	flows      *grid.FlowCache
+	paths      *grid.PathService
+	// snapshot is a copy of the grid for the path service to search. the cells within snapshot_dirty are copied into it
+	// on the next request, while snapshot_mu keeps the workers out, and only the tiles of its hierarchy they touch are
+	// rebuilt. it's cloned again when the grid is replaced.
+	snapshot           *grid.Grid
+	snapshot_hierarchy *grid.Hierarchy
+	snapshot_mu        sync.RWMutex
+	snapshot_dirty     image.Rectangle
+	// entrances are the entrances of the snapshot's hierarchy for agents of entrances_size, which is 0 when they have to
+	// be found again.
+	entrances      []grid.Vec2i
+	entrances_size int
+	// input_cycles is only for user input handling, one per cell.
+	input_cycles []int
+	// brush is the terrain that left-click paints, or wall_brush.
+	brush grid.Terrain
+	// history holds the edits that can be undone and redone. stroke is the edit being painted, until the mouse button
+	// is released.
+	history history
+	stroke  *edit
+	// seed, corridor and density are the settings of the generators.
+	seed     float64
+	corridor float64
+	density  float64
+	// cell_size is how many pixels wide a cell is on the canvas, which is scaled down to fit the viewport when even a
+	// pixel per cell is too big.
+	cell_size int
+	// max_distance is the clearance cap: the largest player size and the space at which the distance field is drawn
+	// white.
+	max_distance float64
+	// new_width and new_height are the size of the grid made by the New Grid button.
+	new_width  float64
+	new_height float64
 
 	draw_distance_field bool
 	draw_grids          bool
+	draw_flow_field     bool
+	draw_vision         bool
+	vision_radius       float64
 	grid_dirty          bool
-	grid_image          *ebiten.Image
+	// dirty_cells are the cells that need to be repainted when the whole grid isn't dirty.
+	dirty_cells image.Rectangle
+	// canvas is what everything is drawn onto before it's scaled to the viewport.
+	canvas     *ebiten.Image
+	grid_image *ebiten.Image
+	// flow_image holds the arrows of flow_drawn, so they're only drawn when the flow field changes.
+	flow_image *ebiten.Image
+	flow_drawn *grid.FlowField
+	// vision_image darkens the cells the player can't see from vision_drawn. vision_dirty is set by edits.
+	vision_image *ebiten.Image
+	vision_drawn grid.Vec2i
+	vision_dirty bool
 
 	player_x    int
 	player_y    int
 	player_size float64
 
 	max_reach float64
-	goal      vec2i
-	path      []vec2i
-	path_ok   bool
+	// max_expanded is the node budget of the player's path queries, where 0 is no limit.
+	max_expanded float64
+	// clearance_weight makes the player's paths keep away from walls, where 0 lets them hug the walls.
+	clearance_weight float64
+	// follow makes shift-clicking a goal start following, and following walks the player along the path.
+	follow    bool
+	following bool
+	search    search_mode
+	any_angle bool
+	// waypoints is the path pulled into a string when any_angle is set.
+	waypoints []grid.Vec2i
+
+	agents []agent
+	// selected is the agent whose goal is set by shift-clicking instead of the player's, or -1.
+	selected     int
+	run_agents   bool
+	agent_timer  int
+	agent_steps  int
+	agents_dirty bool
+
+	slots      save_slots
+	slot_names []string
+	slot_name  string
+	// import_path is the PNG, PGM or MovingAI map file that Import reads.
+	import_path string
+	// unsaved is set by edits and cleared whenever the map is saved or autosaved.
+	unsaved       bool
+	last_autosave int
+	status        string
+	goal          grid.Vec2i
+	path          []grid.Vec2i
+	path_ok       bool
+	path_status   grid.PathStatus
+	path_expanded int
+	// path_pending is set while the path for the latest request is being searched.
+	path_pending bool
 }
 
-func (g *distance_field) in_bounds(x, y int) bool {
-	return x >= 0 && y >= 0 && x < grid_size && y < grid_size
+func (g *distance_field) cell_at(x, y int) *grid.Cell {
+	return g.grid.At(x, y)
 }
 
-func (g *distance_field) cell_at(x, y int) *cell {
-	if g.in_bounds(x, y) {
-		return &g.cells[x+(y*grid_size)]
+// paint_cell applies the brush to a cell once per drag. the wall brush toggles it, and the others open it and paint its
+// terrain.
+func (g *distance_field) paint_cell(x, y int) {
+	if cell := g.cell_at(x, y); cell != nil {
+		input_cycle := &g.input_cycles[x+(y*g.grid.Width())]
+		if *input_cycle != g.drag_cycle {
+			*input_cycle = g.drag_cycle
+			p := grid.Vec2i{X: x, Y: y}
+			before := g.grid.Edit(p)
+			var dirty image.Rectangle
+			if g.brush == wall_brush {
+				dirty = g.grid.SetClosed(x, y, !cell.Closed())
+			} else {
+				dirty = g.grid.SetClosed(x, y, false).Union(g.grid.SetTerrain(x, y, g.brush))
+			}
+			g.stroke_cell(before, g.grid.Edit(p))
+			if !dirty.Empty() {
+				g.grid_changed(dirty)
+				g.update_path()
+			}
+		}
 	}
-	return nil
 }
 
-func (g *distance_field) cell_at_pos(p vec2i) *cell {
-	return g.cell_at(p.x, p.y)
-}
+// follow_step moves the player one cell along the path. the path is replanned after every step and every edit, so
+// toggling cells on the remaining route reroutes the player. following stops at the goal, or at the end of a partial
+// path when the goal can't be reached.
+func (g *distance_field) follow_step() {
+	if g.path_pending {
+		return
+	}
+	route := g.path
+	if g.any_angle {
+		route = grid.Unsmooth(g.waypoints)
+	}
+	if len(route) < 2 {
+		g.following = false
+		if !g.path_ok {
+			g.set_status(fmt.Sprintf("stopped following, path %v", g.path_status))
+		}
+		return
+	}
 
-func (f *distance_field) update() error {
-	return nil
+	next := route[1]
+	dx, dy := next.X-g.player_x, next.Y-g.player_y
+	player_size := int(g.player_size)
+	if !g.cell_at(next.X, next.Y).Traversable(player_size) ||
+		(dx != 0 && dy != 0 && (!g.cell_at(next.X, g.player_y).Traversable(player_size) || !g.cell_at(g.player_x, next.Y).Traversable(player_size))) {
+		// the path is recomputed after every change, so this only happens when it's stale.
+		g.following = false
+		return
+	}
+	g.player_x, g.player_y = next.X, next.Y
+	g.move_timer = g.step_delay()
+	g.update_path()
 }
 
-func (f *distance_field) draw(screen *ebiten.Image) {
-
+// step_delay is how long the player waits after stepping onto its cell, which is longer on rougher terrain.
+func (g *distance_field) step_delay() int {
+	return int(math.Round(move_delay * g.cell_at(g.player_x, g.player_y).Terrain().Cost()))
 }
 
-type path_args struct {
-	start vec2i
-	goal  vec2i
-	// min_space is the minimum required space for any given cell to allow traversal.
-	min_space int
-	// max_distance determines the farthest from the start position we should be allowed to search. no limit <= 0
-	max_distance int
-	// max_reach determines the farthest distance from the goal we're allowed to form a path to.
-	max_reach int
+// grid_changed invalidates everything derived from the cells within r.
+func (g *distance_field) grid_changed(r image.Rectangle) {
+	g.dirty_cells = g.dirty_cells.Union(r)
+	g.flows.Invalidate(r)
+	g.snapshot_dirty = g.snapshot_dirty.Union(r)
+	g.vision_dirty = true
+	g.agents_dirty = true
+	g.unsaved = true
 }
 
-type direction int
-
-const (
-	northwest direction = iota
-	north
-	northeast
-	east
-	southeast
-	south
-	southwest
-	west
-)
-
-var path_directions = [...]direction{
-	north,
-	east,
-	south,
-	west,
-	northwest,
-	northeast,
-	southeast,
-	southwest,
-}
-
-func (d direction) vec2i() vec2i {
-	switch d {
-	case northwest:
-		return vec2i{-1, -1}
-	case north:
-		return vec2i{0, -1}
-	case northeast:
-		return vec2i{1, -1}
-	case east:
-		return vec2i{1, 0}
-	case southeast:
-		return vec2i{1, 1}
-	case south:
-		return vec2i{0, 1}
-	case southwest:
-		return vec2i{-1, 1}
-	case west:
-		return vec2i{-1, 0}
-	default:
-		return vec2i{0, 0}
+func (g *distance_field) refresh_slots() {
+	names, err := g.slots.list()
+	if err != nil {
+		g.set_status(err.Error())
 	}
+	g.slot_names = names
 }
 
-func (d direction) rotate_ccw() direction {
-	return (d + 7) & 0b111
+func (g *distance_field) set_status(status string) {
+	g.status = status
 }
 
-func (d direction) rotate_cw() direction {
-	return (d + 1) & 0b111
+func (g *distance_field) save_slot(name string) error {
+	var buf bytes.Buffer
+	if err := grid.Encode(&buf, g.grid, g.scene()); err != nil {
+		return err
+	}
+	if err := g.slots.write(name, buf.Bytes()); err != nil {
+		return err
+	}
+	g.unsaved = false
+	g.last_autosave = g.cycle
+	g.refresh_slots()
+	return nil
 }
 
-func (d direction) diagonal() bool {
-	return d&1 == 0
+func (g *distance_field) load_slot(name string) error {
+	data, err := g.slots.read(name)
+	if err != nil {
+		return err
+	}
+	loaded, scene, err := grid.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	g.set_grid(loaded)
+	if scene != nil {
+		g.set_scene(scene)
+	}
+	g.unsaved = false
+	g.update_path()
+	return nil
 }
 
-func (g *distance_field) bfs(arg path_args) ([]vec2i, bool) {
-	visited := make(map[vec2i]struct{})
-	prev := make(map[vec2i]vec2i)
-
-	construct_path := func(end vec2i) (path []vec2i) {
-		for end != arg.start {
-			path = append(path, end)
-			end = prev[end]
-		}
-		path = append(path, arg.start)
-		slices.Reverse(path)
+// set_grid replaces the grid being edited with gr, which may be a different size. everything derived from the old grid
+// is dropped, the player and goal are moved onto the new one, and agents that don't fit on it are removed.
+func (g *distance_field) set_grid(gr *grid.Grid) {
+	resized := g.grid == nil || gr.Width() != g.grid.Width() || gr.Height() != g.grid.Height()
+	g.grid = gr
+	g.snapshot = nil
+	g.flows = grid.NewFlowCache(gr)
+	g.flow_drawn = nil
+	g.input_cycles = make([]int, gr.Width()*gr.Height())
+	g.dirty_cells = image.Rectangle{}
+	g.grid_dirty = true
+	g.grid_changed(gr.Bounds())
+	if !resized {
 		return
 	}
 
-	queue := []vec2i{arg.start}
-	visited[arg.start] = struct{}{}
-
-	max_reach := arg.max_reach * arg.max_reach
-	max_distance := arg.max_distance * arg.max_distance
-
-	var closest vec2i
-	var closest_distance int = math.MaxInt
-
-	for len(queue) > 0 {
-		cur := queue[0]
-		queue = queue[1:]
-
-		distance := cur.distance_sq(arg.goal)
-
-		if max_distance > 0 && distance > max_distance {
-			continue
-		}
-
-		if cur == arg.goal {
-			return construct_path(arg.goal), true
+	g.cell_size = max(1, grid_size_px/max(gr.Width(), gr.Height()))
+	for _, img := range []**ebiten.Image{&g.canvas, &g.grid_image, &g.flow_image, &g.vision_image} {
+		if *img != nil {
+			(*img).Deallocate()
+			*img = nil
 		}
+	}
 
-		if max_reach > 0 && distance < closest_distance && distance <= max_reach {
-			closest = cur
-			closest_distance = distance
+	g.player_x = min(max(g.player_x, 0), gr.Width()-1)
+	g.player_y = min(max(g.player_y, 0), gr.Height()-1)
+	g.goal.X = min(max(g.goal.X, 0), gr.Width()-1)
+	g.goal.Y = min(max(g.goal.Y, 0), gr.Height()-1)
+	for i := len(g.agents) - 1; i >= 0; i-- {
+		if a := g.agents[i]; gr.AtPos(a.pos) == nil || gr.AtPos(a.goal) == nil {
+			g.remove_agent(i)
 		}
+	}
+}
 
-		can_traverse := func(c *cell) bool {
-			if c == nil {
-				return false
-			} else if c.closed {
-				return false
-			} else if c.space < arg.min_space {
-				return false
-			}
-			return true
-		}
-
-		for _, dir := range path_directions {
-			next := cur.add(dir.vec2i())
-
-			if _, skip := visited[next]; skip {
-				continue
-			}
-
-			if dir.diagonal() {
-				if cell := g.cell_at_pos(cur.add(dir.rotate_cw().vec2i())); !can_traverse(cell) {
-					continue
-				} else if cell := g.cell_at_pos(cur.add(dir.rotate_ccw().vec2i())); !can_traverse(cell) {
-					continue
-				}
-			}
-
-			visited[next] = struct{}{}
+// new_layer makes an image the size of the canvas.
+func (g *distance_field) new_layer() *ebiten.Image {
+	return ebiten.NewImage(g.grid.Width()*g.cell_size, g.grid.Height()*g.cell_size)
+}
 
-			if cell := g.cell_at_pos(next); !can_traverse(cell) {
-				continue
-			}
+// canvas_scale is how much the canvas is scaled down to fit the viewport.
+func (g *distance_field) canvas_scale() float64 {
+	return min(1, float64(grid_size_px)/float64(max(g.grid.Width(), g.grid.Height())*g.cell_size))
+}
 
-			prev[next] = cur
-			queue = append(queue, next)
-		}
-	}
+// cursor_cell is the cell under the cursor, which may be outside of the grid.
+func (g *distance_field) cursor_cell() grid.Vec2i {
+	cx, cy := ebiten.CursorPosition()
+	size := float64(g.cell_size) * g.canvas_scale()
+	return grid.Vec2i{X: int(math.Floor(float64(cx) / size)), Y: int(math.Floor(float64(cy) / size))}
+}
 
-	// we didn't reach our goal, but we can still return a sub-optimal.
-	if max_reach > 0 && closest_distance != math.MaxInt {
-		return construct_path(closest), false
-	}
+// cell_rect is where the cell at pos is on the canvas, shrunk by inset pixels on every side as far as the cell size
+// allows.
+func (g *distance_field) cell_rect(pos grid.Vec2i, inset float32) (x, y, size float32) {
+	size = float32(g.cell_size)
+	inset = min(inset, (size-1)/2)
+	return float32(pos.X*g.cell_size) + .5 + inset, float32(pos.Y*g.cell_size) + .5 + inset, size - 2*inset
+}
 
-	return nil, false
+// cell_center is the middle of the cell at pos on the canvas.
+func (g *distance_field) cell_center(pos grid.Vec2i) (x, y float32) {
+	half := float32(g.cell_size) * 0.5
+	return float32(pos.X*g.cell_size) + half, float32(pos.Y*g.cell_size) + half
 }
 
-func (g *distance_field) update_cell(x, y int) (ok bool) {
-	if cell := g.cell_at(x, y); cell != nil {
-		if cell.closed {
-			cell.space = 0
+// import_file replaces the grid with the file at path. it may be one of our own maps, which bring their scene along, or
+// a MovingAI map, which brings its own size. anything else is an image, which is resampled to the size of the grid.
+func (g *distance_field) import_file(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	imported, scene, err := grid.Decode(bytes.NewReader(data))
+	if errors.Is(err, grid.ErrNotMap) {
+		if strings.EqualFold(filepath.Ext(path), ".map") {
+			imported, err = grid.DecodeMovingAI(bytes.NewReader(data))
 		} else {
-			cell.space = max_distance
-			for dy := -max_distance; dy <= max_distance; dy++ {
-				for dx := -max_distance; dx <= max_distance; dx++ {
-					if dx == 0 && dy == 0 {
-						continue
-					}
-					other_x := x + dx
-					other_y := y + dy
-					distance := min(sqrt_int(dx*dx+dy*dy), max_distance)
-					if int(distance) >= cell.space {
-						continue
-					}
-					other := g.cell_at(other_x, other_y)
-					if other == nil || other.closed {
-						cell.space = int(distance)
-					}
-				}
-			}
+			imported, err = grid.ImportImage(bytes.NewReader(data), g.grid.Width(), g.grid.Height())
 		}
-		g.grid_dirty = true
-		return true
 	}
-	return false
+	if err != nil {
+		return err
+	}
+	g.set_grid(imported)
+	if scene != nil {
+		g.set_scene(scene)
+	}
+	g.update_path()
+	return nil
 }
 
-func (g *distance_field) update_cells(x0, y0, x1, y1 int) {
-	for y := y0; y < y1; y++ {
-		for x := x0; x < x1; x++ {
-			g.update_cell(x, y)
+// export_images writes the grid, its space and the player's path as PNGs into the save directory, named after the
+// current slot. it returns the names of the files.
+func (g *distance_field) export_images() ([]string, error) {
+	if err := valid_slot_name(g.slot_name); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(g.slots.dir, 0755); err != nil {
+		return nil, err
+	}
+	exports := []struct {
+		suffix string
+		img    image.Image
+	}{
+		{"occupancy", g.grid.OccupancyImage()},
+		{"space", g.grid.SpaceImage(int(g.max_distance))},
+		{"path", g.grid.PathImage(g.path)},
+	}
+	var names []string
+	for _, export := range exports {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, export.img); err != nil {
+			return names, err
+		}
+		name := filepath.Join(g.slots.dir, g.slot_name+"-"+export.suffix+".png")
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			return names, err
 		}
+		names = append(names, name)
 	}
+	return names, nil
 }
 
-func (g *distance_field) update_all_cells() {
-	g.update_cells(0, 0, grid_size, grid_size)
-}
-
-type tile_data struct {
-	X           int
-	Y           int
-	ClosedCells uint64
+// generate replaces the grid with a map from one of the generators.
+func (g *distance_field) generate(name string, generator func(seed uint64)) {
+	seed := uint64(max(g.seed, 0))
+	g.record(name, func() {
+		generator(seed)
+	})
+	g.grid_changed(g.grid.Bounds())
+	g.update_path()
+	g.set_status(fmt.Sprintf("generated %s with seed %d", name, seed))
 }
 
 func (g *distance_field) Load() error {
-	g.cells = make([]cell, grid_size*grid_size)
+	g.paths = grid.NewPathService(path_workers)
+	g.new_width, g.new_height = float64(*grid_width), float64(*grid_height)
+	g.max_distance = float64(*max_space)
 	g.player_size = 1
-	g.goal = vec2i{16, 16}
-	g.update_all_cells()
+	g.vision_radius = 32
+	g.goal = grid.Vec2i{X: 16, Y: 16}
+	g.selected = -1
+	g.brush = wall_brush
+	g.corridor = 2
+	g.density = 0.3
+	g.set_grid(grid.New(*grid_width, *grid_height))
+	g.unsaved = false
+	g.slots = save_slots{dir: default_save_dir()}
+	g.slot_name = "default"
+	g.last_autosave = g.cycle
+	g.refresh_slots()
 	g.update_path()
 	return nil
 }
 
+// Unload stops the path workers.
+func (g *distance_field) Unload() {
+	g.paths.Close()
+}
+
 func (g *distance_field) Update() error {
+	for _, response := range g.paths.Poll() {
+		if response.ID == player_request {
+			g.path_pending = false
+			g.path, g.path_ok = response.Path, response.Status == grid.PathFound
+			g.path_status, g.path_expanded = response.Status, response.Expanded
+			g.waypoints = nil
+			if g.any_angle {
+				g.waypoints = g.grid.Smooth(g.path, response.Args.MinSpace)
+			}
+		} else if i := response.ID - agent_request; i >= 0 && i < len(g.agents) && response.Status == grid.PathFound {
+			// a plan made before the agent moved or was replaced is of no use, so plan again.
+			a, arg := &g.agents[i], response.Args
+			if arg.Start == a.pos && arg.Goal == a.goal && arg.MinSpace == a.size {
+				a.plan = response.Path
+			} else {
+				g.agents_dirty = true
+			}
+		}
+	}
+
 	if ebiten.IsKeyPressed(ebiten.KeyShift) {
 		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
-			cx, cy := ebiten.CursorPosition()
-			grid_x, grid_y := cx/cell_size, cy/cell_size
-			g.goal = vec2i{grid_x, grid_y}
-			g.update_path()
+			if g.selected != -1 {
+				g.agents[g.selected].goal = g.cursor_cell()
+				g.agents_dirty = true
+			} else {
+				g.goal = g.cursor_cell()
+				g.update_path()
+				g.following = g.follow
+			}
 		}
 	} else {
 		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 			g.drag_cycle = g.cycle
+			g.begin_stroke()
 		} else if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
-			cx, cy := ebiten.CursorPosition()
-			grid_x, grid_y := cx/cell_size, cy/cell_size
-			if cell := g.cell_at(grid_x, grid_y); cell != nil && cell._input_cycle != g.drag_cycle {
-				cell._input_cycle = g.drag_cycle
-				cell.closed = !cell.closed
-				g.update_cells(grid_x-max_distance, grid_y-max_distance, grid_x+max_distance, grid_y+max_distance)
-				g.update_path()
+			cell := g.cursor_cell()
+			g.paint_cell(cell.X, cell.Y)
+		}
+	}
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		g.end_stroke()
+	}
+
+	if ebiten.IsKeyPressed(ebiten.KeyControl) {
+		if inpututil.IsKeyJustPressed(ebiten.KeyZ) {
+			if ebiten.IsKeyPressed(ebiten.KeyShift) {
+				g.redo()
+			} else {
+				g.undo()
 			}
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+			g.redo()
 		}
 	}
 
-	var dir direction = -1
+	var dir grid.Direction = -1
 	if ebiten.IsKeyPressed(ebiten.KeyW) {
-		dir = north
+		dir = grid.North
 	} else if ebiten.IsKeyPressed(ebiten.KeyS) {
-		dir = south
+		dir = grid.South
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyA) {
-		if dir == north {
-			dir = northwest
-		} else if dir == south {
-			dir = southwest
+		if dir == grid.North {
+			dir = grid.Northwest
+		} else if dir == grid.South {
+			dir = grid.Southwest
 		} else {
-			dir = west
+			dir = grid.West
 		}
 	} else if ebiten.IsKeyPressed(ebiten.KeyD) {
-		if dir == north {
-			dir = northeast
-		} else if dir == south {
-			dir = southeast
+		if dir == grid.North {
+			dir = grid.Northeast
+		} else if dir == grid.South {
+			dir = grid.Southeast
 		} else {
-			dir = east
+			dir = grid.East
 		}
 	}
 
+	if dir != -1 {
+		g.following = false
+	}
+
+	if g.move_timer == 0 && g.following {
+		g.follow_step()
+	}
+
 	if g.move_timer == 0 && dir != -1 {
-		v := dir.vec2i()
+		v := dir.Vec2i()
 		player_size := int(g.player_size)
 
-		ok := g.cell_at(g.player_x+v.x, g.player_y+v.y).traversable(player_size)
+		ok := g.cell_at(g.player_x+v.X, g.player_y+v.Y).Traversable(player_size)
 
 		// diagonal movement
-		if ok && dir.diagonal() {
-			if !g.cell_at(g.player_x+v.x, g.player_y).traversable(player_size) {
-				v.x = 0
+		if ok && dir.Diagonal() {
+			if !g.cell_at(g.player_x+v.X, g.player_y).Traversable(player_size) {
+				v.X = 0
 			}
-			if !g.cell_at(g.player_x, g.player_y+v.y).traversable(player_size) {
-				v.y = 0
+			if !g.cell_at(g.player_x, g.player_y+v.Y).Traversable(player_size) {
+				v.Y = 0
 			}
 		}
 
-		if !ok && g.cell_at(g.player_x+v.x, g.player_y).traversable(player_size) {
+		if !ok && g.cell_at(g.player_x+v.X, g.player_y).Traversable(player_size) {
 			ok = true
-			v.y = 0
+			v.Y = 0
 		}
 
-		if !ok && g.cell_at(g.player_x, g.player_y+v.y).traversable(player_size) {
+		if !ok && g.cell_at(g.player_x, g.player_y+v.Y).Traversable(player_size) {
 			ok = true
-			v.x = 0
+			v.X = 0
 		}
 
 		if ok {
-			g.player_x += v.x
-			g.player_y += v.y
-			g.move_timer = 3
+			g.player_x += v.X
+			g.player_y += v.Y
+			g.move_timer = g.step_delay()
 			g.update_path()
 		}
 	}
 
+	if g.agents_dirty {
+		g.plan_agents()
+	}
+	if g.run_agents && g.agent_timer == 0 && len(g.agents) > 0 && !g.agents_planning() {
+		g.step_agents()
+		g.agent_timer = move_delay
+	}
+
+	if g.unsaved && g.cycle-g.last_autosave >= autosave_interval {
+		if err := g.save_slot(autosave_slot); err != nil {
+			g.set_status(fmt.Sprintf("autosave failed: %v", err))
+		} else {
+			g.set_status("autosaved")
+		}
+	}
+
 	g.cycle++
 
 	if g.move_timer > 0 {
 		g.move_timer--
 	}
+	if g.agent_timer > 0 {
+		g.agent_timer--
+	}
 	return nil
 }
 
@@ -406,86 +639,196 @@ func (g *distance_field) Menu(ctx *debugui.Context) {
 	ctx.LayoutColumn(func() {
 		ctx.SetLayoutRow([]int{74, -1}, 16)
 		ctx.Label("Player Size")
-		if ctx.Slider(&g.player_size, 1, max_distance, 1, 0) == debugui.ResponseChange {
+		if ctx.Slider(&g.player_size, 1, g.max_distance, 1, 0) == debugui.ResponseChange {
 			g.update_path()
 		}
 		ctx.Label("Max Reach")
 		if ctx.Slider(&g.max_reach, 0, 64, 1, 0) == debugui.ResponseChange {
 			g.update_path()
 		}
+		ctx.Label("Budget")
+		if ctx.Slider(&g.max_expanded, 0, 4096, 64, 0) == debugui.ResponseChange {
+			g.update_path()
+		}
+		ctx.Label("Clearance")
+		if ctx.Slider(&g.clearance_weight, 0, 8, 0.25, 2) == debugui.ResponseChange {
+			g.update_path()
+		}
 
-		if ctx.Button("Save") == debugui.ResponseSubmit {
-			var tiles []tile_data
-			for tile_y := 0; tile_y < grid_tile_divisions; tile_y++ {
-				for tile_x := 0; tile_x < grid_tile_divisions; tile_x++ {
-					grid_x := tile_x * tile_size
-					grid_y := tile_y * tile_size
-					var closed_cells uint64
-					for y0 := 0; y0 < tile_size; y0++ {
-						for x0 := 0; x0 < tile_size; x0++ {
-							closed_cells <<= 1
-							cell_x := grid_x + x0
-							cell_y := grid_y + y0
-							if cell := g.cell_at(cell_x, cell_y); cell == nil || cell.closed {
-								closed_cells |= 1
-							}
-						}
-					}
-					tiles = append(tiles, tile_data{
-						X:           tile_x,
-						Y:           tile_y,
-						ClosedCells: closed_cells,
-					})
-				}
+		if ctx.Button("Clear") == debugui.ResponseSubmit {
+			g.record("clear", func() {
+				g.grid.Fill(false)
+				g.grid.FillTerrain(grid.TerrainRoad)
+			})
+			g.grid_changed(g.grid.Bounds())
+			g.update_path()
+		}
+		if ctx.Button("Fill") == debugui.ResponseSubmit {
+			g.record("fill", func() {
+				g.grid.Fill(true)
+			})
+			g.grid_changed(g.grid.Bounds())
+			g.update_path()
+		}
+		if ctx.Button("Undo") == debugui.ResponseSubmit {
+			g.undo()
+		}
+		if ctx.Button("Redo") == debugui.ResponseSubmit {
+			g.redo()
+		}
+
+		ctx.Label("Seed")
+		ctx.Number(&g.seed, 1, 0)
+		if ctx.Button("Caves") == debugui.ResponseSubmit {
+			g.generate("caves", func(seed uint64) { g.grid.GenerateCaves(seed, cave_fill, cave_steps) })
+		}
+		if ctx.Button("Maze") == debugui.ResponseSubmit {
+			g.generate("a maze", func(seed uint64) { g.grid.GenerateMaze(seed, int(g.corridor)) })
+		}
+		if ctx.Button("Rooms") == debugui.ResponseSubmit {
+			g.generate("rooms", func(seed uint64) { g.grid.GenerateRooms(seed, min_room) })
+		}
+		if ctx.Button("Scatter") == debugui.ResponseSubmit {
+			g.generate("scatter", func(seed uint64) { g.grid.GenerateScatter(seed, g.density) })
+		}
+		ctx.Label("Corridor")
+		ctx.Slider(&g.corridor, 1, 8, 1, 0)
+		ctx.Label("Density")
+		ctx.Slider(&g.density, 0, 1, 0.05, 2)
+		if ctx.Button("New Seed") == debugui.ResponseSubmit {
+			g.seed = float64(rand.IntN(1 << 20))
+		}
+
+		ctx.SetLayoutRow([]int{-1}, 16)
+		ctx.Label("Brush")
+		ctx.SetLayoutRow([]int{44, 44, 44, 44, -1}, 16)
+		for brush := grid.Terrain(0); brush <= wall_brush; brush++ {
+			name := "Walls"
+			if brush != wall_brush {
+				name = brush.String()
+				name = strings.ToUpper(name[:1]) + name[1:]
+			}
+			label := name
+			if brush == g.brush {
+				label = "[" + name + "]"
+			}
+			if ctx.Button(label+"\x00brush:"+name) == debugui.ResponseSubmit {
+				g.brush = brush
 			}
+		}
 
-			var buf bytes.Buffer
-			enc := gob.NewEncoder(&buf)
-			if err := enc.Encode(tiles); err != nil {
-				log.Println(err)
-			} else if err = os.WriteFile("save.dat", buf.Bytes(), 0755); err != nil {
-				log.Println(err)
+		ctx.SetLayoutRow([]int{74, -1}, 16)
+		ctx.Label("Width")
+		ctx.Slider(&g.new_width, tile_size, max_grid_size, tile_size, 0)
+		ctx.Label("Height")
+		ctx.Slider(&g.new_height, tile_size, max_grid_size, tile_size, 0)
+		if ctx.Button("New Grid") == debugui.ResponseSubmit {
+			g.record("new grid", func() {
+				g.set_grid(grid.New(int(g.new_width), int(g.new_height)))
+			})
+			g.update_path()
+			g.set_status(fmt.Sprintf("new %dx%d grid", g.grid.Width(), g.grid.Height()))
+		}
+		ctx.Label("Max Space")
+		if ctx.Slider(&g.max_distance, 1, max_max_distance, 1, 0) == debugui.ResponseChange {
+			g.grid_dirty = true
+			if g.player_size > g.max_distance {
+				g.player_size = g.max_distance
+				g.update_path()
 			}
-			log.Printf("data length: %d", buf.Len())
 		}
 
-		if ctx.Button("Load") == debugui.ResponseSubmit {
-			data, err := os.ReadFile("save.dat")
+		ctx.Label("Slot")
+		ctx.TextBox(&g.slot_name)
+		if ctx.Button("Save") == debugui.ResponseSubmit {
+			if err := g.save_slot(g.slot_name); err != nil {
+				g.set_status(err.Error())
+			} else {
+				g.set_status(fmt.Sprintf("saved %q", g.slot_name))
+			}
+		}
+		if ctx.Button("Refresh") == debugui.ResponseSubmit {
+			g.refresh_slots()
+		}
+		ctx.Label("File")
+		ctx.TextBox(&g.import_path)
+		if ctx.Button("Import") == debugui.ResponseSubmit {
+			var err error
+			g.record("import", func() {
+				err = g.import_file(g.import_path)
+			})
 			if err != nil {
-				log.Println(err)
+				g.set_status(err.Error())
 			} else {
-				dec := gob.NewDecoder(bytes.NewReader(data))
-				var chunks []tile_data
-				if err = dec.Decode(&chunks); err != nil {
-					log.Println(err)
+				g.set_status(fmt.Sprintf("imported %q", g.import_path))
+			}
+		}
+		if ctx.Button("Export") == debugui.ResponseSubmit {
+			if names, err := g.export_images(); err != nil {
+				g.set_status(err.Error())
+			} else {
+				g.set_status(fmt.Sprintf("exported %d images to %s", len(names), g.slots.dir))
+			}
+		}
+
+		ctx.SetLayoutRow([]int{-1, 40, 48}, 16)
+		for _, name := range g.slot_names {
+			ctx.Label(name)
+			if ctx.Button("Load\x00load:"+name) == debugui.ResponseSubmit {
+				var err error
+				g.record("load", func() {
+					err = g.load_slot(name)
+				})
+				if err != nil {
+					g.set_status(err.Error())
+				} else {
+					g.slot_name = name
+					g.set_status(fmt.Sprintf("loaded %q", name))
+				}
+			}
+			if ctx.Button("Delete\x00delete:"+name) == debugui.ResponseSubmit {
+				if err := g.slots.delete(name); err != nil {
+					g.set_status(err.Error())
 				} else {
-					for _, chunk := range chunks {
-						chunk_x := chunk.X * tile_size
-						chunk_y := chunk.Y * tile_size
-						closed_cells := chunk.ClosedCells
-						for y := tile_size - 1; y >= 0; y-- {
-							for x := tile_size - 1; x >= 0; x-- {
-								g.cell_at(x+chunk_x, y+chunk_y).closed = closed_cells&1 == 1
-								closed_cells >>= 1
-							}
-						}
-					}
+					g.set_status(fmt.Sprintf("deleted %q", name))
 				}
-				g.update_all_cells()
+				g.refresh_slots()
 			}
 		}
 
-		if ctx.Button("Clear") == debugui.ResponseSubmit {
-			for i := range g.cells {
-				g.cells[i].closed = false
+		ctx.SetLayoutRow([]int{-1}, 16)
+		if g.status != "" {
+			ctx.Label(g.status)
+		}
+
+		ctx.SetLayoutRow([]int{74, -1}, 16)
+		if ctx.Button("Add Agent") == debugui.ResponseSubmit {
+			if len(g.agents) >= max_agents {
+				g.set_status(fmt.Sprintf("there can be at most %d agents", max_agents))
+			} else if !g.add_agent(int(g.player_size)) {
+				g.set_status("no room for another agent")
 			}
-			g.update_all_cells()
 		}
-		if ctx.Button("Fill") == debugui.ResponseSubmit {
-			for i := range g.cells {
-				g.cells[i].closed = true
+		ctx.Checkbox("Run Agents", &g.run_agents)
+
+		ctx.SetLayoutRow([]int{-1, 56, 48}, 16)
+		for i, a := range g.agents {
+			ctx.Label(fmt.Sprintf("Agent %d, size %d", i+1, a.size))
+			label := "Select"
+			if g.selected == i {
+				label = "Deselect"
+			}
+			if ctx.Button(fmt.Sprintf("%s\x00select:%d", label, i)) == debugui.ResponseSubmit {
+				if g.selected == i {
+					g.selected = -1
+				} else {
+					g.selected = i
+				}
+			}
+			if ctx.Button(fmt.Sprintf("Remove\x00remove:%d", i)) == debugui.ResponseSubmit {
+				g.remove_agent(i)
+				break
 			}
-			g.update_all_cells()
 		}
 	})
 	ctx.LayoutColumn(func() {
@@ -496,9 +839,28 @@ func (g *distance_field) Menu(ctx *debugui.Context) {
 		if ctx.Checkbox("Draw Distance Field", &g.draw_distance_field) == debugui.ResponseChange {
 			g.grid_dirty = true
 		}
+		ctx.Checkbox("Draw Flow Field", &g.draw_flow_field)
+		ctx.Checkbox("Draw Vision", &g.draw_vision)
+		if g.draw_vision {
+			if ctx.Slider(&g.vision_radius, 1, float64(max(g.grid.Width(), g.grid.Height())), 1, 0) == debugui.ResponseChange {
+				g.vision_dirty = true
+			}
+		}
+		if ctx.Button("Search: "+g.search.String()) == debugui.ResponseSubmit {
+			g.search = (g.search + 1) % search_mode_count
+			g.update_path()
+		}
+		if ctx.Checkbox("Any Angle", &g.any_angle) == debugui.ResponseChange {
+			g.update_path()
+		}
+		if ctx.Checkbox("Follow Path", &g.follow) == debugui.ResponseChange && !g.follow {
+			g.following = false
+		}
 		ctx.Label("")
 		ctx.Label("Left-click and drag to toggle the cells")
-		ctx.Label("open/closed state.")
+		ctx.Label("open/closed state, or to paint terrain")
+		ctx.Label("with any other brush. Rougher terrain")
+		ctx.Label("costs more to walk through.")
 		ctx.Label("")
 		ctx.Label("The number on each cell represents the")
 		ctx.Label("available capacity for that cell.")
@@ -508,95 +870,292 @@ func (g *distance_field) Menu(ctx *debugui.Context) {
 		ctx.Label("move into that cell.")
 		ctx.Label("")
 		ctx.Label("Hold shift and left-click to set the")
-		ctx.Label("goal.")
+		ctx.Label("goal. With Follow Path, the player")
+		ctx.Label("walks there on their own.")
+		ctx.Label("")
+		ctx.Label("Agents are added with the player size.")
+		ctx.Label("Shift-clicking sets the goal of the")
+		ctx.Label("selected agent instead of the player.")
+		ctx.Label("")
+		ctx.Label("Ctrl+Z undoes a stroke, Clear, Fill,")
+		ctx.Label("Load, import or generated map, and")
+		ctx.Label("Ctrl+Y or Ctrl+Shift+Z redoes it.")
 		ctx.Label("")
 
+		ctx.Label(fmt.Sprintf("Path: %v, %d expanded", g.path_status, g.path_expanded))
 		ctx.Label(fmt.Sprintf("TPS: %.3f", ebiten.ActualTPS()))
 		ctx.Label(fmt.Sprintf("FPS: %.3f", ebiten.ActualFPS()))
 		close_button(ctx)
 	})
 }
 
+// scene captures everything needed to replay the current path query.
+func (g *distance_field) scene() *grid.Scene {
+	return &grid.Scene{
+		Player:          grid.Vec2i{X: g.player_x, Y: g.player_y},
+		Goal:            g.goal,
+		PlayerSize:      int(g.player_size),
+		MaxReach:        int(g.max_reach),
+		Search:          g.search.id(),
+		ClearanceWeight: g.clearance_weight,
+		MaxExpanded:     int(g.max_expanded),
+	}
+}
+
+func (g *distance_field) set_scene(scene *grid.Scene) {
+	g.player_x, g.player_y = scene.Player.X, scene.Player.Y
+	g.goal = scene.Goal
+	g.player_size = float64(max(scene.PlayerSize, 1))
+	g.max_distance = max(g.max_distance, g.player_size)
+	g.max_reach = float64(scene.MaxReach)
+	g.clearance_weight = scene.ClearanceWeight
+	g.max_expanded = float64(scene.MaxExpanded)
+	for mode := search_mode(0); mode < search_mode_count; mode++ {
+		// older maps saved the label instead of the id.
+		if mode.id() == scene.Search || mode.String() == scene.Search {
+			g.search = mode
+		}
+	}
+}
+
+// update_path requests a new path for the player. it arrives on a later tick, and until then the old one is kept.
 func (g *distance_field) update_path() {
-	g.path, g.path_ok = g.bfs(path_args{
-		start:        vec2i{g.player_x, g.player_y},
-		goal:         g.goal,
-		min_space:    int(g.player_size),
-		max_distance: 0,
-		max_reach:    int(g.max_reach),
-	})
+	args := grid.PathArgs{
+		Start:           grid.Vec2i{X: g.player_x, Y: g.player_y},
+		Goal:            g.goal,
+		MinSpace:        int(g.player_size),
+		MaxDistance:     0,
+		MaxReach:        int(g.max_reach),
+		MaxExpanded:     int(g.max_expanded),
+		ClearanceWeight: g.clearance_weight,
+	}
+	g.sync_snapshot()
+
+	search := g.snapshot.Search
+	switch g.search {
+	case search_jps:
+		search = g.snapshot.SearchJPS
+	case search_hierarchy:
+		search = g.snapshot_hierarchy.Search
+	}
+	g.paths.Request(grid.PathRequest{ID: player_request, Args: args, Search: func(arg grid.PathArgs) grid.PathResult {
+		g.snapshot_mu.RLock()
+		defer g.snapshot_mu.RUnlock()
+		return search(arg)
+	}})
+	g.path_pending = true
 }
 
-func (g *distance_field) Draw(screen *ebiten.Image) {
-	if g.grid_dirty {
-		g.grid_dirty = false
-		log.Println("repaint grid")
-		if g.grid_image == nil {
-			g.grid_image = ebiten.NewImage(grid_size_px, grid_size_px)
-			// g.grid_image = ebiten.NewImageWithOptions(image.Rect(0, 0, grid_size_px, grid_size_px), &ebiten.NewImageOptions{
-			// 	Unmanaged: true,
-			// })
-		}
-		g.grid_image.Clear()
-		for grid_y := 0; grid_y < grid_size; grid_y++ {
-			for grid_x := 0; grid_x < grid_size; grid_x++ {
-				cell_x := float32(grid_x*cell_size) + .5
-				cell_y := float32(grid_y*cell_size) + .5
-				cell := g.cell_at(grid_x, grid_y)
-
-				var clr color.Color = color.RGBA{127, 127, 127, 255}
-
-				if g.draw_distance_field {
-					grey := uint8((cell.space * 255) / max_distance)
-					clr = color.RGBA{
-						grey, grey, grey, 255,
-					}
-				} else {
-					if cell.closed {
-						clr = color.Black
-					}
+// sync_snapshot copies the cells that changed since the last request into the snapshot. the requests still running on
+// it are cancelled first, and the agents are planned again.
+func (g *distance_field) sync_snapshot() {
+	if g.snapshot == nil {
+		g.snapshot = g.grid.Clone()
+		g.snapshot_hierarchy = grid.NewHierarchy(g.snapshot)
+		g.entrances_size = 0
+	} else if !g.snapshot_dirty.Empty() {
+		// the searches still running on the snapshot are cancelled, so waiting for them is short.
+		g.paths.Cancel(player_request)
+		for i := range max_agents {
+			g.paths.Cancel(agent_request + i)
+		}
+		g.agents_dirty = true
+		g.snapshot_mu.Lock()
+		g.snapshot.CopyFrom(g.grid, g.snapshot_dirty)
+		g.snapshot_hierarchy.Invalidate(g.snapshot_dirty)
+		g.snapshot_mu.Unlock()
+		g.entrances_size = 0
+	}
+	g.snapshot_dirty = image.Rectangle{}
+}
+
+// repaint redraws the cells within r onto the cached grid image. drawing is clipped to r so the cells and lines around
+// it aren't painted twice.
+func (g *distance_field) repaint(r image.Rectangle) {
+	if g.grid_image == nil {
+		g.grid_image = g.new_layer()
+	}
+	cell_size := g.cell_size
+	dst := g.grid_image.SubImage(image.Rect(r.Min.X*cell_size, r.Min.Y*cell_size, r.Max.X*cell_size, r.Max.Y*cell_size)).(*ebiten.Image)
+	dst.Clear()
+
+	max_distance := int(g.max_distance)
+	// strokes overlap the neighbouring cells by a pixel, so include them.
+	r = r.Inset(-1).Intersect(g.grid.Bounds())
+	for grid_y := r.Min.Y; grid_y < r.Max.Y; grid_y++ {
+		for grid_x := r.Min.X; grid_x < r.Max.X; grid_x++ {
+			cell_x, cell_y, size := g.cell_rect(grid.Vec2i{X: grid_x, Y: grid_y}, 0)
+			cell := g.cell_at(grid_x, grid_y)
+
+			var clr color.Color = terrain_colors[cell.Terrain()]
+
+			if g.draw_distance_field {
+				grey := uint8((min(cell.Space(), max_distance) * 255) / max_distance)
+				clr = color.RGBA{
+					grey, grey, grey, 255,
+				}
+			} else {
+				if cell.Closed() {
+					clr = color.Black
 				}
+			}
 
-				vector.DrawFilledRect(g.grid_image, cell_x, cell_y, cell_size, cell_size, clr, false)
+			vector.DrawFilledRect(dst, cell_x, cell_y, size, size, clr, false)
+
+			if g.draw_grids && cell_size > 2 {
+				vector.StrokeRect(dst, cell_x, cell_y, size, size, 1, color.RGBA{64, 64, 64, 64}, false)
+			}
+		}
+	}
+
+	if g.draw_grids {
+		tile_size_px := cell_size * tile_size
+		for chunk_y := r.Min.Y / tile_size; chunk_y*tile_size < r.Max.Y; chunk_y++ {
+			for chunk_x := r.Min.X / tile_size; chunk_x*tile_size < r.Max.X; chunk_x++ {
+				x := float32(chunk_x*tile_size_px) + .5
+				y := float32(chunk_y*tile_size_px) + .5
+				vector.StrokeRect(dst, x, y, float32(tile_size_px-1), float32(tile_size_px-1), 1, color.RGBA{16, 48, 98, 128}, false)
+			}
+		}
+	}
+}
 
-				if g.draw_grids {
-					vector.StrokeRect(g.grid_image, cell_x, cell_y, cell_size, cell_size, 1, color.RGBA{64, 64, 64, 64}, false)
+// draw_flow draws an arrow on every cell pointing the way to the goal for the player's size.
+func (g *distance_field) draw_flow(screen *ebiten.Image) {
+	field := g.flows.Get(g.goal, int(g.player_size))
+	if g.flow_image == nil {
+		g.flow_image = g.new_layer()
+	}
+	if field != g.flow_drawn {
+		g.flow_drawn = field
+		g.flow_image.Clear()
+		clr := color.RGBA{255, 160, 32, 160}
+		length := float32(g.cell_size) * 0.45
+		for grid_y := 0; grid_y < g.grid.Height(); grid_y++ {
+			for grid_x := 0; grid_x < g.grid.Width(); grid_x++ {
+				pos := grid.Vec2i{X: grid_x, Y: grid_y}
+				dir, ok := field.Direction(pos)
+				if !ok {
+					continue
 				}
+				v := dir.Vec2i()
+				x, y := g.cell_center(pos)
+				head_x := x + float32(v.X)*length
+				head_y := y + float32(v.Y)*length
+				vector.StrokeLine(g.flow_image, x, y, head_x, head_y, 1, clr, false)
+				vector.DrawFilledCircle(g.flow_image, head_x, head_y, 0.75, clr, false)
 			}
 		}
+	}
+	screen.DrawImage(g.flow_image, nil)
+}
 
-		if g.draw_grids {
-			for chunk_y := 0; chunk_y < grid_tile_divisions; chunk_y++ {
-				for chunk_x := 0; chunk_x < grid_tile_divisions; chunk_x++ {
-					x := float32(chunk_x*tile_size_px) + .5
-					y := float32(chunk_y*tile_size_px) + .5
-					vector.StrokeRect(g.grid_image, x, y, tile_size_px-1, tile_size_px-1, 1, color.RGBA{16, 48, 98, 128}, false)
+// draw_fov darkens every cell the player can't see.
+func (g *distance_field) draw_fov(screen *ebiten.Image) {
+	player := grid.Vec2i{X: g.player_x, Y: g.player_y}
+	if g.vision_image == nil {
+		g.vision_image = g.new_layer()
+		g.vision_dirty = true
+	}
+	if g.vision_dirty || player != g.vision_drawn {
+		g.vision_dirty = false
+		g.vision_drawn = player
+		width, height := g.grid.Width(), g.grid.Height()
+		visible := make([]bool, width*height)
+		for _, p := range g.grid.FieldOfView(player, int(g.vision_radius)) {
+			visible[p.X+(p.Y*width)] = true
+		}
+		g.vision_image.Clear()
+		for grid_y := 0; grid_y < height; grid_y++ {
+			for grid_x := 0; grid_x < width; grid_x++ {
+				if !visible[grid_x+(grid_y*width)] {
+					x, y, size := g.cell_rect(grid.Vec2i{X: grid_x, Y: grid_y}, 0)
+					vector.DrawFilledRect(g.vision_image, x-.5, y-.5, size, size, color.RGBA{0, 0, 0, 160}, false)
 				}
 			}
 		}
 	}
+	screen.DrawImage(g.vision_image, nil)
+}
+
+func (g *distance_field) Draw(screen *ebiten.Image) {
+	if g.grid_dirty {
+		g.grid_dirty = false
+		g.dirty_cells = g.grid.Bounds()
+	}
+	if !g.dirty_cells.Empty() {
+		g.repaint(g.dirty_cells)
+		g.dirty_cells = image.Rectangle{}
+	}
+
+	if g.canvas == nil {
+		g.canvas = g.new_layer()
+	}
+	canvas := g.canvas
+	canvas.DrawImage(g.grid_image, &ebiten.DrawImageOptions{Blend: ebiten.BlendCopy})
 
-	screen.DrawImage(g.grid_image, nil)
+	if g.draw_flow_field {
+		g.draw_flow(canvas)
+	}
+	if g.draw_vision {
+		g.draw_fov(canvas)
+	}
+
+	if g.draw_grids && g.search == search_hierarchy && g.snapshot_hierarchy != nil {
+		// they come from the hierarchy that's searched, and only change along with it.
+		if size := int(g.player_size); g.entrances_size != size {
+			g.entrances = g.snapshot_hierarchy.Entrances(size)
+			g.entrances_size = size
+		}
+		for _, pos := range g.entrances {
+			x, y, size := g.cell_rect(pos, 1)
+			vector.DrawFilledRect(canvas, x, y, size, size, color.RGBA{32, 96, 196, 160}, false)
+		}
+	}
 
 	clr := color.RGBA{64, 255, 128, 255}
 
 	if !g.path_ok {
 		clr = color.RGBA{255, 64, 128, 255}
-		cell_x := float32(g.goal.x*cell_size) + .5
-		cell_y := float32(g.goal.y*cell_size) + .5
-		vector.DrawFilledRect(screen, cell_x+1, cell_y+1, cell_size-2, cell_size-2, clr, false)
+		x, y, size := g.cell_rect(g.goal, 1)
+		vector.DrawFilledRect(canvas, x, y, size, size, clr, false)
 	}
 
-	for _, pos := range g.path {
-		cell_x := float32(pos.x*cell_size) + .5
-		cell_y := float32(pos.y*cell_size) + .5
-		vector.DrawFilledRect(screen, cell_x+3, cell_y+3, cell_size-5, cell_size-5, clr, false)
+	if g.any_angle {
+		for i, pos := range g.waypoints {
+			x, y := g.cell_center(pos)
+			if i > 0 {
+				prev_x, prev_y := g.cell_center(g.waypoints[i-1])
+				vector.StrokeLine(canvas, prev_x, prev_y, x, y, 1, clr, false)
+			}
+			vector.DrawFilledCircle(canvas, x, y, 1.5, clr, false)
+		}
+	} else {
+		for _, pos := range g.path {
+			x, y, size := g.cell_rect(pos, 1.5)
+			vector.DrawFilledRect(canvas, x, y, size, size, clr, false)
+		}
 	}
 
-	player_x := float32(g.player_x*cell_size) + (cell_size * 0.5)
-	player_y := float32(g.player_y*cell_size) + (cell_size * 0.5)
-	vector.DrawFilledCircle(screen, player_x+1, player_y+1, 2, color.RGBA{0, 0, 0, 64}, false)
-	vector.DrawFilledCircle(screen, player_x, player_y, 2, color.RGBA{0, 255, 0, 255}, false)
-	vector.StrokeCircle(screen, player_x+1, player_y+1, float32((1+2*(g.player_size-1))*cell_size*0.5), 1, color.RGBA{0, 0, 0, 64}, false)
-	vector.StrokeCircle(screen, player_x, player_y, float32((1+2*(g.player_size-1))*cell_size*0.5), 1, color.RGBA{0, 255, 0, 255}, false)
+	for i, a := range g.agents {
+		clr := color.RGBA{64, 160, 255, 255}
+		if i == g.selected {
+			clr = color.RGBA{255, 200, 64, 255}
+			for _, pos := range a.plan {
+				x, y, size := g.cell_rect(pos, 1.5)
+				vector.DrawFilledRect(canvas, x, y, size, size, clr, false)
+			}
+			x, y, size := g.cell_rect(a.goal, 1)
+			vector.StrokeRect(canvas, x, y, size, size, 1, clr, false)
+		}
+		g.draw_agent(canvas, a.pos, float64(a.size), clr)
+	}
+
+	g.draw_agent(canvas, grid.Vec2i{X: g.player_x, Y: g.player_y}, g.player_size, color.RGBA{0, 255, 0, 255})
+
+	var op ebiten.DrawImageOptions
+	scale := g.canvas_scale()
+	op.GeoM.Scale(scale, scale)
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(canvas, &op)
 }
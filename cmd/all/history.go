@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+
+	"github.com/galsjel/go-playground/grid"
+)
+
+// history_limit is how many bytes of edits are kept for undoing. the oldest edits are forgotten past it.
+const history_limit = 64 << 20
+
+// edit is an undoable change to the grid. before and after hold the states of the cells that changed. when the grid was
+// replaced with one of another size, old_size and new_size are set and before and after hold the cells of each grid
+// that aren't open roads, which is all it takes to rebuild them. old_scene and new_scene are set when the scene changed
+// too.
+type edit struct {
+	name      string
+	before    []grid.CellEdit
+	after     []grid.CellEdit
+	old_size  image.Point
+	new_size  image.Point
+	old_scene *grid.Scene
+	new_scene *grid.Scene
+}
+
+func (e *edit) empty() bool {
+	return len(e.before) == 0 && len(e.after) == 0 && e.old_size == e.new_size && e.old_scene == nil
+}
+
+// size estimates how many bytes e keeps alive.
+func (e *edit) size() int {
+	return (len(e.before) + len(e.after)) * int(unsafe.Sizeof(grid.CellEdit{}))
+}
+
+type history struct {
+	undo  []edit
+	redo  []edit
+	bytes int
+}
+
+// push records e as the latest edit, which makes whatever was undone before it impossible to redo.
+func (h *history) push(e edit) {
+	for i := range h.redo {
+		h.bytes -= h.redo[i].size()
+	}
+	h.redo = nil
+	h.undo = append(h.undo, e)
+	h.bytes += e.size()
+	for h.bytes > history_limit && len(h.undo) > 0 {
+		h.bytes -= h.undo[0].size()
+		// the backing array outlives the slice, so the cells it holds have to be let go of here.
+		h.undo[0] = edit{}
+		h.undo = h.undo[1:]
+	}
+}
+
+// changed_cells returns the states in a and in b of the cells that differ between them. a and b are the same size.
+func changed_cells(a, b *grid.Grid) (before, after []grid.CellEdit) {
+	for y := 0; y < a.Height(); y++ {
+		for x := 0; x < a.Width(); x++ {
+			p := grid.Vec2i{X: x, Y: y}
+			if from, to := a.Edit(p), b.Edit(p); from != to {
+				before = append(before, from)
+				after = append(after, to)
+			}
+		}
+	}
+	return before, after
+}
+
+// custom_cells returns the states of the cells of gr that differ from those of a new grid.
+func custom_cells(gr *grid.Grid) []grid.CellEdit {
+	_, states := changed_cells(grid.New(gr.Width(), gr.Height()), gr)
+	return states
+}
+
+// record runs op, which may change any cell, replace the grid or change the scene, and makes what it did a single edit
+// in the history.
+func (g *distance_field) record(name string, op func()) {
+	g.end_stroke()
+	old := g.grid.Clone()
+	old_scene := *g.scene()
+	op()
+	new_scene := *g.scene()
+
+	e := edit{name: name}
+	if g.grid.Width() != old.Width() || g.grid.Height() != old.Height() {
+		e.old_size = image.Pt(old.Width(), old.Height())
+		e.new_size = image.Pt(g.grid.Width(), g.grid.Height())
+		e.before, e.after = custom_cells(old), custom_cells(g.grid)
+	} else {
+		e.before, e.after = changed_cells(old, g.grid)
+	}
+	if old_scene != new_scene {
+		e.old_scene, e.new_scene = &old_scene, &new_scene
+	}
+	if !e.empty() {
+		g.history.push(e)
+	}
+}
+
+// begin_stroke starts recording the cells painted until the mouse button is released as a single edit.
+func (g *distance_field) begin_stroke() {
+	g.end_stroke()
+	g.stroke = &edit{name: "stroke"}
+}
+
+// stroke_cell adds the change of a cell from before to after to the current stroke.
+func (g *distance_field) stroke_cell(before, after grid.CellEdit) {
+	if g.stroke != nil && before != after {
+		g.stroke.before = append(g.stroke.before, before)
+		g.stroke.after = append(g.stroke.after, after)
+	}
+}
+
+// end_stroke adds the current stroke to the history, unless it didn't change anything.
+func (g *distance_field) end_stroke() {
+	if g.stroke != nil && !g.stroke.empty() {
+		g.history.push(*g.stroke)
+	}
+	g.stroke = nil
+}
+
+// apply puts the grid in the state before or after an edit. the cells are set to states, on a new grid when size is
+// set, and the scene is restored when it's set. only the clearance around the cells that change is updated.
+func (g *distance_field) apply(states []grid.CellEdit, size image.Point, scene *grid.Scene) {
+	if size != (image.Point{}) {
+		gr := grid.New(size.X, size.Y)
+		gr.SetCells(states)
+		g.set_grid(gr)
+	} else if dirty := g.grid.SetCells(states); !dirty.Empty() {
+		g.grid_changed(dirty)
+	}
+	if scene != nil {
+		g.set_scene(scene)
+	}
+	g.update_path()
+}
+
+func (g *distance_field) undo() {
+	g.end_stroke()
+	h := &g.history
+	if len(h.undo) == 0 {
+		g.set_status("nothing to undo")
+		return
+	}
+	e := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	g.apply(e.before, e.old_size, e.old_scene)
+	h.redo = append(h.redo, e)
+	g.set_status(fmt.Sprintf("undid %s", e.name))
+}
+
+func (g *distance_field) redo() {
+	g.end_stroke()
+	h := &g.history
+	if len(h.redo) == 0 {
+		g.set_status("nothing to redo")
+		return
+	}
+	e := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	g.apply(e.after, e.new_size, e.new_scene)
+	h.undo = append(h.undo, e)
+	g.set_status(fmt.Sprintf("redid %s", e.name))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"image"
 	"log"
 	"time"
@@ -26,8 +27,23 @@ type subgame interface {
 
 var main_game *game
 
+// the size of the distance field grid and its clearance cap, which can also be changed from its menu.
+var (
+	grid_width  = flag.Int("width", default_grid_size, "width of the distance field grid in cells")
+	grid_height = flag.Int("height", default_grid_size, "height of the distance field grid in cells")
+	max_space   = flag.Int("max-space", default_max_distance, "largest player size in the distance field")
+)
+
+// unloader is implemented by subgames that have to clean up after themselves when they're closed.
+type unloader interface {
+	Unload()
+}
+
 func close_button(ctx *debugui.Context) {
 	if ctx.Button("Close") == debugui.ResponseSubmit {
+		if u, ok := main_game.subgame.(unloader); ok {
+			u.Unload()
+		}
 		main_game.subgame = nil
 	}
 }
@@ -94,6 +110,14 @@ func (a *game) Layout(outside_width, outside_height int) (width, height int) {
 }
 
 func main() {
+	flag.Parse()
+	if *grid_width < 1 || *grid_height < 1 || *grid_width > max_grid_size || *grid_height > max_grid_size {
+		log.Fatalf("the grid must be between 1x1 and %dx%d cells", max_grid_size, max_grid_size)
+	}
+	if *max_space < 1 {
+		log.Fatal("max-space must be at least 1")
+	}
+
 	ebiten.SetWindowTitle("Playground")
 	ebiten.SetWindowSize(game_width*game_scale, game_height*game_scale)
 	main_game = &game{
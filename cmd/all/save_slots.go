@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	save_slot_ext = ".map"
+
+	autosave_slot = "autosave"
+	// autosave_interval is how many ticks pass between autosaves of unsaved edits.
+	autosave_interval = 60 * 30
+)
+
+// save_slots is a directory of named map files.
+type save_slots struct {
+	dir string
+}
+
+// default_save_dir is where slots are kept unless told otherwise. it falls back to the working directory when there's
+// no config directory.
+func default_save_dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "saves"
+	}
+	return filepath.Join(dir, "go-playground", "saves")
+}
+
+func valid_slot_name(name string) error {
+	if name == "" {
+		return errors.New("slot name is empty")
+	}
+	if strings.ContainsAny(name, `/\:`) || name == "." || name == ".." {
+		return fmt.Errorf("slot name %q is not a valid file name", name)
+	}
+	return nil
+}
+
+func (s save_slots) path(name string) string {
+	return filepath.Join(s.dir, name+save_slot_ext)
+}
+
+// list returns the name of every slot, sorted.
+func (s save_slots) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), save_slot_ext); ok && entry.Type().IsRegular() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s save_slots) read(name string) ([]byte, error) {
+	if err := valid_slot_name(name); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(s.path(name))
+}
+
+// write replaces the slot atomically. the data goes to a temporary file in the same directory which is then renamed
+// over the slot, so a crash leaves either the old or the new map behind and never half of one.
+func (s save_slots) write(name string, data []byte) error {
+	if err := valid_slot_name(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, name+save_slot_ext+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(name))
+}
+
+func (s save_slots) delete(name string) error {
+	if err := valid_slot_name(name); err != nil {
+		return err
+	}
+	return os.Remove(s.path(name))
+}
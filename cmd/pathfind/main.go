@@ -0,0 +1,154 @@
+// pathfind answers a path query on a map saved by the distance field scene, and prints the path, how the search ended
+// and what it took as JSON.
+//
+//	pathfind -map file.map [-start x,y] [-goal x,y] [-min-space n] [-max-distance n] [-max-reach n]
+//	         [-max-expanded n] [-clearance-weight w] [-search name]
+//
+// the query defaults to the scene saved with the map, if there is one.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/galsjel/go-playground/grid"
+)
+
+var (
+	map_path         = flag.String("map", "", "the map file to search")
+	start            = flag.String("start", "", "where the path starts, as x,y")
+	goal             = flag.String("goal", "", "where the path should end, as x,y")
+	min_space        = flag.Int("min-space", 1, "the clearance every cell along the path needs")
+	max_distance     = flag.Int("max-distance", 0, "how far from the start the search may go, or no limit when 0")
+	max_reach        = flag.Int("max-reach", 0, "how far from the goal a partial path may end, or none when 0")
+	max_expanded     = flag.Int("max-expanded", 0, "how many nodes the search may expand, or no limit when 0")
+	clearance_weight = flag.Float64("clearance-weight", 0, "how much more stepping onto cells close to walls costs")
+	search_name      = flag.String("search", "", "the search to run: astar, jps or hierarchy. defaults to the scene's, or astar")
+)
+
+// searches are keyed by the ids scenes save them under.
+var searches = map[string]func(g *grid.Grid) func(grid.PathArgs) grid.PathResult{
+	grid.SearchAStar: func(g *grid.Grid) func(grid.PathArgs) grid.PathResult { return g.Search },
+	grid.SearchJPS:   func(g *grid.Grid) func(grid.PathArgs) grid.PathResult { return g.SearchJPS },
+	grid.SearchHierarchy: func(g *grid.Grid) func(grid.PathArgs) grid.PathResult {
+		return grid.NewHierarchy(g).Search
+	},
+}
+
+type output struct {
+	Status   string   `json:"status"`
+	Found    bool     `json:"found"`
+	Path     [][2]int `json:"path"`
+	Length   float64  `json:"length"`
+	Expanded int      `json:"expanded"`
+	// Micros is how long the search took, without loading the map.
+	Micros int64 `json:"micros"`
+}
+
+func parse_vec(s string) (grid.Vec2i, error) {
+	var v grid.Vec2i
+	if _, err := fmt.Sscanf(s, "%d,%d", &v.X, &v.Y); err != nil {
+		return v, fmt.Errorf("%q is not x,y", s)
+	}
+	return v, nil
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	if *map_path == "" {
+		log.Fatal("usage: pathfind -map file.map [flags]")
+	}
+
+	f, err := os.Open(*map_path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g, scene, err := grid.Decode(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := grid.PathArgs{
+		MinSpace:        *min_space,
+		MaxDistance:     *max_distance,
+		MaxReach:        *max_reach,
+		MaxExpanded:     *max_expanded,
+		ClearanceWeight: *clearance_weight,
+	}
+	search := grid.SearchAStar
+	if scene != nil {
+		args = scene.PathArgs()
+		if _, ok := searches[scene.Search]; ok {
+			search = scene.Search
+		} else if scene.Search != "" {
+			log.Printf("the scene's search %q is unknown, so %s is run instead", scene.Search, search)
+		}
+	} else if *start == "" || *goal == "" {
+		log.Fatal("the map has no scene, so -start and -goal are needed")
+	}
+
+	// flags override the scene.
+	var flag_err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "start":
+			args.Start, flag_err = parse_vec(*start)
+		case "goal":
+			args.Goal, flag_err = parse_vec(*goal)
+		case "min-space":
+			args.MinSpace = *min_space
+		case "max-distance":
+			args.MaxDistance = *max_distance
+		case "max-reach":
+			args.MaxReach = *max_reach
+		case "max-expanded":
+			args.MaxExpanded = *max_expanded
+		case "clearance-weight":
+			args.ClearanceWeight = *clearance_weight
+		case "search":
+			search = *search_name
+		}
+	})
+	if flag_err != nil {
+		log.Fatal(flag_err)
+	}
+
+	query, ok := searches[search]
+	if !ok {
+		log.Fatalf("unknown search %q", search)
+	}
+	if err := write_output(os.Stdout, answer(query(g), args)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// answer runs the query and times it.
+func answer(query func(grid.PathArgs) grid.PathResult, args grid.PathArgs) output {
+	began := time.Now()
+	result := query(args)
+	elapsed := time.Since(began)
+
+	out := output{
+		Status:   result.Status.String(),
+		Found:    result.Status == grid.PathFound,
+		Path:     make([][2]int, len(result.Path)),
+		Length:   grid.PathLength(result.Path),
+		Expanded: result.Expanded,
+		Micros:   elapsed.Microseconds(),
+	}
+	for i, p := range result.Path {
+		out.Path[i] = [2]int{p.X, p.Y}
+	}
+	return out
+}
+
+func write_output(w io.Writer, out output) error {
+	return json.NewEncoder(w).Encode(out)
+}
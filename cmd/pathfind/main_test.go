@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/galsjel/go-playground/grid"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestOutput answers the scene saved with a map with every search and compares the JSON to testdata/<search>.golden.
+func TestOutput(t *testing.T) {
+	g := grid.New(10, 6)
+	for y := 0; y < 5; y++ {
+		g.SetClosed(4, y, true)
+	}
+	var buf bytes.Buffer
+	scene := &grid.Scene{Player: grid.Vec2i{X: 1, Y: 1}, Goal: grid.Vec2i{X: 8, Y: 1}, PlayerSize: 1}
+
+	for id := range searches {
+		t.Run(id, func(t *testing.T) {
+			scene.Search = id
+			buf.Reset()
+			if err := grid.Encode(&buf, g, scene); err != nil {
+				t.Fatal(err)
+			}
+			loaded, loaded_scene, err := grid.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := answer(searches[loaded_scene.Search](loaded), loaded_scene.PathArgs())
+			// the time taken is the only part that changes from run to run.
+			out.Micros = 0
+			var got bytes.Buffer
+			if err := write_output(&got, out); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", id+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("got\n%swant\n%s", got.Bytes(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// scenarios runs MovingAI benchmark scenario files through the path queries of the grid package, and reports the
+// length, the deviation from the optimal length, the expanded nodes and the time of every query.
+//
+//	scenarios [-search astar|jps|hierarchy] [-map file] [-bucket n] [-summary] file.scen...
+//
+// the map of a scenario is looked up next to its scenario file, unless -map says otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/galsjel/go-playground/grid"
+)
+
+// tolerance is how far a length may be from the optimal one and still count as optimal. the scenario files round
+// their lengths to 8 decimals.
+const tolerance = 1e-4
+
+var (
+	search_name  = flag.String("search", grid.SearchAStar, "the search to run: astar, jps or hierarchy")
+	map_override = flag.String("map", "", "the map to run every scenario on, instead of the one it names")
+	bucket       = flag.Int("bucket", -1, "only run the scenarios of this bucket, or every one when negative")
+	summary_only = flag.Bool("summary", false, "only print the summary of every scenario file")
+)
+
+// min_space is the clearance of every query, since the benchmarks are for agents of a single cell.
+const min_space = 1
+
+// searcher answers queries on a map. the hierarchy is built once per map, outside of the timed queries.
+type searcher func(g *grid.Grid) func(grid.PathArgs) grid.PathResult
+
+var searchers = map[string]searcher{
+	grid.SearchAStar: func(g *grid.Grid) func(grid.PathArgs) grid.PathResult { return g.Search },
+	grid.SearchJPS:   func(g *grid.Grid) func(grid.PathArgs) grid.PathResult { return g.SearchJPS },
+	grid.SearchHierarchy: func(g *grid.Grid) func(grid.PathArgs) grid.PathResult {
+		h := grid.NewHierarchy(g)
+		h.Build(min_space)
+		return h.Search
+	},
+}
+
+type map_entry struct {
+	g      *grid.Grid
+	search func(grid.PathArgs) grid.PathResult
+}
+
+type summary struct {
+	scenarios  int
+	found      int
+	optimal    int
+	deviation  float64
+	worst      float64
+	expanded   int
+	total_time time.Duration
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	new_searcher, ok := searchers[*search_name]
+	if !ok {
+		log.Fatalf("unknown search %q", *search_name)
+	}
+	if flag.NArg() == 0 {
+		log.Fatal("usage: scenarios [flags] file.scen...")
+	}
+
+	maps := map[string]map_entry{}
+	load_map := func(path string) (map_entry, error) {
+		if entry, ok := maps[path]; ok {
+			return entry, nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return map_entry{}, err
+		}
+		defer f.Close()
+		g, err := grid.DecodeMovingAI(f)
+		if err != nil {
+			return map_entry{}, fmt.Errorf("%s: %w", path, err)
+		}
+		entry := map_entry{g, new_searcher(g)}
+		maps[path] = entry
+		return entry, nil
+	}
+
+	for _, name := range flag.Args() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+		if !*summary_only {
+			fmt.Fprintln(w, "bucket\tstart\tgoal\tstatus\tlength\toptimal\tdeviation\texpanded\ttime\t")
+		}
+		s, err := run(w, name, load_map)
+		w.Flush()
+		if err != nil {
+			log.Fatal(err)
+		}
+		mean := 0.0
+		if s.found > 0 {
+			mean = s.deviation / float64(s.found)
+		}
+		fmt.Printf("%s: %d scenarios, %d found, %d optimal, mean deviation %.4f, worst %.4f, %d expanded in %v\n",
+			name, s.scenarios, s.found, s.optimal, mean, s.worst, s.expanded, s.total_time)
+	}
+}
+
+// run answers every scenario in the file called name, and prints a line for each unless only the summary is wanted.
+func run(w *tabwriter.Writer, name string, load_map func(string) (map_entry, error)) (s summary, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return s, err
+	}
+	scenarios, err := grid.DecodeScenarios(f)
+	f.Close()
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", name, err)
+	}
+
+	for _, scenario := range scenarios {
+		if *bucket >= 0 && scenario.Bucket != *bucket {
+			continue
+		}
+		path := *map_override
+		if path == "" {
+			path = filepath.Join(filepath.Dir(name), filepath.Base(scenario.Map))
+		}
+		entry, err := load_map(path)
+		if err != nil {
+			return s, err
+		}
+		if entry.g.Width() != scenario.Width || entry.g.Height() != scenario.Height {
+			return s, fmt.Errorf("%s: map %s is %dx%d, the scenarios want %dx%d", name, path, entry.g.Width(), entry.g.Height(), scenario.Width, scenario.Height)
+		}
+
+		start := time.Now()
+		result := entry.search(grid.PathArgs{Start: scenario.Start, Goal: scenario.Goal, MinSpace: min_space})
+		elapsed := time.Since(start)
+
+		s.scenarios++
+		s.expanded += result.Expanded
+		s.total_time += elapsed
+		length, deviation := grid.PathLength(result.Path), 0.0
+		if result.Status == grid.PathFound {
+			deviation = length - scenario.Optimal
+			s.found++
+			s.deviation += deviation
+			s.worst = max(s.worst, deviation)
+			if deviation <= tolerance {
+				s.optimal++
+			}
+		}
+		if !*summary_only {
+			fmt.Fprintf(w, "%d\t%d,%d\t%d,%d\t%v\t%.4f\t%.4f\t%.4f\t%d\t%v\t\n", scenario.Bucket, scenario.Start.X, scenario.Start.Y,
+				scenario.Goal.X, scenario.Goal.Y, result.Status, length, scenario.Optimal, deviation, result.Expanded, elapsed)
+		}
+	}
+	return s, nil
+}
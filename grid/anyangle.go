@@ -0,0 +1,90 @@
+package grid
+
+import "slices"
+
+// supercover calls visit for every cell the line between the centers of a and b passes through, from a to b, and stops
+// early when visit returns false. when the line passes exactly through a corner, both cells beside the corner are
+// visited before the one across it if corners is set, which matches the corner rule of the path searches. without
+// them, the visited cells form a walk of adjacent cells.
+func supercover(a, b Vec2i, corners bool, visit func(p Vec2i) bool) bool {
+	if !visit(a) {
+		return false
+	}
+	nx, ny := abs(b.X-a.X), abs(b.Y-a.Y)
+	sx, sy := sign(b.X-a.X), sign(b.Y-a.Y)
+	p := a
+	for ix, iy := 0, 0; ix < nx || iy < ny; {
+		// compares where the line crosses the next vertical and horizontal grid lines.
+		switch decision := (1+2*ix)*ny - (1+2*iy)*nx; {
+		case decision == 0:
+			if corners && (!visit(Vec2i{p.X + sx, p.Y}) || !visit(Vec2i{p.X, p.Y + sy})) {
+				return false
+			}
+			p.X += sx
+			p.Y += sy
+			ix++
+			iy++
+		case decision < 0:
+			p.X += sx
+			ix++
+		default:
+			p.Y += sy
+			iy++
+		}
+		if !visit(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// LineOfSight reports whether an agent with min_space clearance can walk in a straight line from the center of a to
+// the center of b, which is when every cell the line touches is traversable.
+func (g *Grid) LineOfSight(a, b Vec2i, min_space int) bool {
+	return supercover(a, b, true, func(p Vec2i) bool {
+		return g.AtPos(p).Traversable(min_space)
+	})
+}
+
+// Smooth pulls a path into a string. it returns the waypoints of path that are needed to walk it in straight lines,
+// where every line keeps min_space clearance. the first and last cells are always kept. it's greedy: it walks the path
+// once, and from each waypoint goes on to the last cell still in sight, so open rooms are crossed in a single line
+// instead of stair-steps, but it may keep a few more waypoints than it needs to. a path that starts in cells without
+// min_space clearance, like one that steps out of a tight corner, keeps those cells and is smoothed from the first one
+// with room.
+func (g *Grid) Smooth(path []Vec2i, min_space int) []Vec2i {
+	start := 0
+	for start < len(path)-1 && !g.AtPos(path[start]).Traversable(min_space) {
+		start++
+	}
+	if len(path)-start <= 2 {
+		return path
+	}
+	waypoints := slices.Clone(path[:start+1])
+	from := path[start]
+	for i := start + 2; i < len(path); i++ {
+		// path[i-1] was in sight of from on the step before, or is next to it, so it can always be the next waypoint.
+		if !g.LineOfSight(from, path[i], min_space) {
+			from = path[i-1]
+			waypoints = append(waypoints, from)
+		}
+	}
+	return append(waypoints, path[len(path)-1])
+}
+
+// Unsmooth expands waypoints back into a chain of adjacent cells by following the lines between them.
+func Unsmooth(waypoints []Vec2i) []Vec2i {
+	if len(waypoints) == 0 {
+		return nil
+	}
+	path := []Vec2i{waypoints[0]}
+	for i := 1; i < len(waypoints); i++ {
+		supercover(waypoints[i-1], waypoints[i], false, func(p Vec2i) bool {
+			if p != waypoints[i-1] {
+				path = append(path, p)
+			}
+			return true
+		})
+	}
+	return path
+}
@@ -0,0 +1,107 @@
+package grid
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestLineOfSight(t *testing.T) {
+	g := parse(
+		"......",
+		"..#...",
+		"......",
+		"......",
+	)
+	tests := []struct {
+		a, b Vec2i
+		want bool
+	}{
+		{Vec2i{0, 0}, Vec2i{5, 0}, true},
+		{Vec2i{0, 1}, Vec2i{5, 1}, false},
+		{Vec2i{0, 2}, Vec2i{5, 3}, true},
+		{Vec2i{1, 0}, Vec2i{3, 2}, false},
+		// passes exactly through the corner of the closed cell.
+		{Vec2i{1, 2}, Vec2i{3, 0}, false},
+		{Vec2i{4, 3}, Vec2i{4, 3}, true},
+	}
+	for _, test := range tests {
+		if got := g.LineOfSight(test.a, test.b, 1); got != test.want {
+			t.Errorf("line of sight from %v to %v = %v, want %v", test.a, test.b, got, test.want)
+		}
+		if got := g.LineOfSight(test.b, test.a, 1); got != test.want {
+			t.Errorf("line of sight from %v to %v = %v, want %v", test.b, test.a, got, test.want)
+		}
+	}
+	if g.LineOfSight(Vec2i{0, 3}, Vec2i{5, 3}, 2) {
+		t.Error("line along the border has clearance 2")
+	}
+}
+
+func TestSmoothOpenRoom(t *testing.T) {
+	g := New(32, 32)
+	path, ok := g.FindPath(PathArgs{Start: Vec2i{2, 3}, Goal: Vec2i{29, 17}, MinSpace: 1})
+	if !ok {
+		t.Fatal("no path")
+	}
+	if got, want := g.Smooth(path, 1), []Vec2i{{2, 3}, {29, 17}}; !slices.Equal(got, want) {
+		t.Errorf("waypoints = %v, want %v", got, want)
+	}
+}
+
+func TestSmoothTightStart(t *testing.T) {
+	g := New(32, 32)
+	found, ok := g.FindPath(PathArgs{Start: Vec2i{2, 2}, Goal: Vec2i{28, 17}, MinSpace: 3})
+	if !ok {
+		t.Fatal("no path")
+	}
+	// the corner has no room for min_space 3, so the path steps out of it first.
+	path := append([]Vec2i{{0, 0}, {1, 1}}, found...)
+	waypoints := g.Smooth(path, 3)
+	if want := []Vec2i{{0, 0}, {1, 1}, {2, 2}, {28, 17}}; !slices.Equal(waypoints, want) {
+		t.Errorf("waypoints = %v, want %v", waypoints, want)
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	rng := rand.New(rand.NewSource(18))
+	for i := 0; i < 200; i++ {
+		g := random_grid(rng, 40, 40, rng.Float64()*0.3)
+		min_space := 1 + rng.Intn(2)
+		args := PathArgs{Start: Vec2i{rng.Intn(40), rng.Intn(40)}, Goal: Vec2i{rng.Intn(40), rng.Intn(40)}, MinSpace: min_space}
+		path, ok := g.FindPath(args)
+		if !ok || !g.AtPos(args.Start).Traversable(min_space) {
+			continue
+		}
+		waypoints := g.Smooth(path, min_space)
+		if waypoints[0] != args.Start || waypoints[len(waypoints)-1] != args.Goal {
+			t.Fatalf("waypoints go from %v to %v", waypoints[0], waypoints[len(waypoints)-1])
+		}
+		if len(waypoints) > len(path) {
+			t.Fatalf("%d waypoints for a path of %d cells", len(waypoints), len(path))
+		}
+		for j := 1; j < len(waypoints); j++ {
+			if !g.LineOfSight(waypoints[j-1], waypoints[j], min_space) {
+				t.Fatalf("no line of sight between waypoints %v and %v", waypoints[j-1], waypoints[j])
+			}
+		}
+		walk := Unsmooth(waypoints)
+		check_path(t, g, walk, min_space)
+		if walk[0] != args.Start || walk[len(walk)-1] != args.Goal {
+			t.Fatalf("walk goes from %v to %v", walk[0], walk[len(walk)-1])
+		}
+	}
+}
+
+func BenchmarkSmooth(b *testing.B) {
+	g := New(512, 512)
+	g.GenerateMaze(1, 1)
+	path, ok := g.FindPath(PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{510, 510}, MinSpace: 1})
+	if !ok {
+		b.Fatal("no path")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Smooth(path, 1)
+	}
+}
@@ -0,0 +1,216 @@
+package grid
+
+import (
+	"container/heap"
+	"image"
+	"math"
+)
+
+// distance_infinity stands in for an infinite squared distance. it's large enough to never win against a real
+// distance and small enough to not overflow when distances are added to it.
+const distance_infinity = 1 << 40
+
+// UpdateAll recomputes the clearance of every cell with an exact euclidean distance transform. the transform is
+// separable, so it runs over every column and then over every row, each in linear time. the grid is padded with a ring
+// of closed cells because everything outside of it counts as closed.
+func (g *Grid) UpdateAll() {
+	g.clear_caches()
+	width, height := g.width, g.height
+	n := max(width, height) + 2
+
+	f := make([]int, n)
+	d := make([]int, n)
+	s := make([]int, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+	columns := make([]int, width*height)
+	// column_sources holds the row of the closest closed cell within the same column.
+	column_sources := make([]int, width*height)
+
+	for x := 0; x < width; x++ {
+		f[0], f[height+1] = 0, 0
+		for y := 0; y < height; y++ {
+			if g.cells[x+(y*width)].closed {
+				f[y+1] = 0
+			} else {
+				f[y+1] = distance_infinity
+			}
+		}
+		distance_transform(f[:height+2], d, s, v, z)
+		for y := 0; y < height; y++ {
+			columns[x+(y*width)] = d[y+1]
+			column_sources[x+(y*width)] = s[y+1] - 1
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		f[0], f[width+1] = 0, 0
+		copy(f[1:], columns[y*width:(y+1)*width])
+		distance_transform(f[:width+2], d, s, v, z)
+		for x := 0; x < width; x++ {
+			cell := &g.cells[x+(y*width)]
+			source_x := s[x+1] - 1
+			if source_x < 0 || source_x >= width {
+				cell.nearest = Vec2i{source_x, y}
+			} else {
+				cell.nearest = Vec2i{source_x, column_sources[source_x+(y*width)]}
+			}
+			cell.distance_sq = d[x+1]
+			cell.space = sqrt_int(d[x+1])
+			cell.raise = false
+		}
+	}
+}
+
+// distance_transform computes the one dimensional squared distance transform of f into d as the lower envelope of
+// the parabolas rooted at each sample, and the index of the sample each distance was measured to into s. v and z are
+// scratch space for the envelope and must hold len(f) and len(f)+1 elements.
+func distance_transform(f, d, s, v []int, z []float64) {
+	intersect := func(q, p int) float64 {
+		return float64((f[q]+q*q)-(f[p]+p*p)) / float64(2*q-2*p)
+	}
+
+	k := 0
+	v[0] = 0
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+	for q := 1; q < len(f); q++ {
+		s := intersect(q, v[k])
+		for s <= z[k] {
+			k--
+			s = intersect(q, v[k])
+		}
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+
+	k = 0
+	for q := range f {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		dq := q - v[k]
+		d[q] = dq*dq + f[v[k]]
+		s[q] = v[k]
+	}
+}
+
+// closed_at is like At(x, y).Closed() except everything outside the grid counts as closed.
+func (g *Grid) closed_at(p Vec2i) bool {
+	if cell := g.AtPos(p); cell != nil {
+		return cell.closed
+	}
+	return true
+}
+
+// nearest_border returns the closest cell just outside of the grid, which is always closed.
+func (g *Grid) nearest_border(p Vec2i) Vec2i {
+	nearest := Vec2i{-1, p.Y}
+	if p.X+1 > g.width-p.X {
+		nearest = Vec2i{g.width, p.Y}
+	}
+	if min(p.Y+1, g.height-p.Y) < min(p.X+1, g.width-p.X) {
+		nearest = Vec2i{p.X, -1}
+		if p.Y+1 > g.height-p.Y {
+			nearest = Vec2i{p.X, g.height}
+		}
+	}
+	return nearest
+}
+
+// update_clearance propagates the closed state changes of the cells at points through the clearance field. it's the
+// dynamic brushfire of Lau, Sprunk and Burgard: opening a cell sends out a raise wavefront that resets every cell that
+// was measured against it, followed by a lower wavefront from the cells around the reset area that still know a valid
+// closed cell. closing a cell only sends out a lower wavefront. both wavefronts stop as soon as distances stop
+// improving, so only the cells whose clearance depends on points are visited. the wavefronts of every point share a
+// queue, so a batch of changes is propagated in one pass. it returns the bounds of every cell whose space changed.
+func (g *Grid) update_clearance(points ...Vec2i) (dirty image.Rectangle) {
+	g.clear_caches()
+	mark := func(p Vec2i, cell *Cell, space int) {
+		if cell.space != space {
+			cell.space = space
+			dirty = dirty.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+		}
+	}
+
+	var open brushfire_queue
+	for _, p := range points {
+		cell := g.AtPos(p)
+		if cell.closed {
+			cell.nearest = p
+			cell.distance_sq = 0
+			mark(p, cell, 0)
+		} else {
+			cell.raise = true
+		}
+		heap.Push(&open, brushfire_entry{p, 0})
+	}
+
+	for open.Len() > 0 {
+		entry := heap.Pop(&open).(brushfire_entry)
+		cur := g.AtPos(entry.pos)
+
+		if cur.raise {
+			// cur measured its clearance against a cell that has been opened. fall back to the closest cell outside of
+			// the grid so it has a valid distance, then let the neighbours lower it again.
+			cur.nearest = g.nearest_border(entry.pos)
+			cur.distance_sq = entry.pos.DistanceSq(cur.nearest)
+			mark(entry.pos, cur, sqrt_int(cur.distance_sq))
+
+			for _, dir := range path_directions {
+				next := entry.pos.Add(dir.Vec2i())
+				n := g.AtPos(next)
+				if n == nil || n.raise {
+					continue
+				}
+				if !g.closed_at(n.nearest) {
+					n.raise = true
+				}
+				heap.Push(&open, brushfire_entry{next, n.distance_sq})
+			}
+			cur.raise = false
+			continue
+		}
+
+		if entry.distance_sq != cur.distance_sq || !g.closed_at(cur.nearest) {
+			continue
+		}
+
+		for _, dir := range path_directions {
+			next := entry.pos.Add(dir.Vec2i())
+			n := g.AtPos(next)
+			if n == nil || n.raise {
+				continue
+			}
+			if distance_sq := next.DistanceSq(cur.nearest); distance_sq < n.distance_sq {
+				n.nearest = cur.nearest
+				n.distance_sq = distance_sq
+				mark(next, n, sqrt_int(distance_sq))
+				heap.Push(&open, brushfire_entry{next, distance_sq})
+			}
+		}
+	}
+	return
+}
+
+type brushfire_entry struct {
+	pos         Vec2i
+	distance_sq int
+}
+
+// brushfire_queue is a min-heap of cells ordered by the squared distance they were queued with.
+type brushfire_queue []brushfire_entry
+
+func (q brushfire_queue) Len() int           { return len(q) }
+func (q brushfire_queue) Less(i, j int) bool { return q[i].distance_sq < q[j].distance_sq }
+func (q brushfire_queue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *brushfire_queue) Push(x any)        { *q = append(*q, x.(brushfire_entry)) }
+
+func (q *brushfire_queue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,172 @@
+package grid
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// brute_force_space is the window scan the clearance field used to be computed with. it finds the closest closed cell
+// within max_distance of x, y and caps the result at max_distance.
+func brute_force_space(g *Grid, x, y, max_distance int) int {
+	if g.At(x, y).closed {
+		return 0
+	}
+	space := max_distance
+	for dy := -max_distance; dy <= max_distance; dy++ {
+		for dx := -max_distance; dx <= max_distance; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			distance := min(sqrt_int(dx*dx+dy*dy), max_distance)
+			if distance >= space {
+				continue
+			}
+			if other := g.At(x+dx, y+dy); other == nil || other.closed {
+				space = distance
+			}
+		}
+	}
+	return space
+}
+
+func TestDistanceTransformMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		width, height := 1+rng.Intn(48), 1+rng.Intn(48)
+		g := random_grid(rng, width, height, rng.Float64()*0.3)
+		uncapped := width + height
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				if got, want := g.At(x, y).Space(), brute_force_space(g, x, y, uncapped); got != want {
+					t.Fatalf("map %d: space at %d,%d = %d, want %d\n%s", i, x, y, got, want, g)
+				}
+			}
+		}
+	}
+}
+
+func TestDistanceTransformMatchesCappedScan(t *testing.T) {
+	const max_distance = 15
+	rng := rand.New(rand.NewSource(3))
+	g := random_grid(rng, 128, 128, 0.01)
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			if got, want := min(g.At(x, y).Space(), max_distance), brute_force_space(g, x, y, max_distance); got != want {
+				t.Fatalf("space at %d,%d = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkUpdateAll(b *testing.B) {
+	g := random_grid(rand.New(rand.NewSource(4)), 128, 128, 0.05)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.UpdateAll()
+	}
+}
+
+func TestSetClosedMatchesUpdateAll(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	for i := 0; i < 20; i++ {
+		width, height := 8+rng.Intn(56), 8+rng.Intn(56)
+		g := random_grid(rng, width, height, rng.Float64()*0.2)
+		for j := 0; j < 200; j++ {
+			x, y := rng.Intn(width), rng.Intn(height)
+			before := make([]int, len(g.cells))
+			for k := range g.cells {
+				before[k] = g.cells[k].space
+			}
+
+			dirty := g.SetClosed(x, y, !g.At(x, y).Closed())
+
+			want := New(width, height)
+			for k := range g.cells {
+				want.cells[k].closed = g.cells[k].closed
+			}
+			want.UpdateAll()
+
+			for k := range g.cells {
+				p := Vec2i{k % width, k / width}
+				if got, want := g.cells[k].distance_sq, want.cells[k].distance_sq; got != want {
+					t.Fatalf("map %d toggle %d at %d,%d: distance at %v = %d, want %d\n%s", i, j, x, y, p, got, want, g)
+				}
+				if g.cells[k].space != before[k] && !(image.Point{p.X, p.Y}).In(dirty) {
+					t.Fatalf("map %d toggle %d: %v changed outside of the dirty rectangle %v", i, j, p, dirty)
+				}
+			}
+		}
+	}
+}
+
+func TestSetCellsMatchesUpdateAll(t *testing.T) {
+	rng := rand.New(rand.NewSource(25))
+	for i := 0; i < 200; i++ {
+		width, height := 8+rng.Intn(40), 8+rng.Intn(40)
+		g := random_grid(rng, width, height, rng.Float64()*0.3)
+		before := g.Clone()
+
+		// a batch of edits that opens and closes cells at once, sometimes the same one twice.
+		var edits []CellEdit
+		for range 1 + rng.Intn(64) {
+			p := Vec2i{rng.Intn(width), rng.Intn(height)}
+			edits = append(edits, CellEdit{p, rng.Intn(2) == 0, Terrain(rng.Intn(int(TerrainCount)))})
+		}
+		dirty := g.SetCells(edits)
+
+		want := New(width, height)
+		for k := range g.cells {
+			want.cells[k].closed = g.cells[k].closed
+		}
+		want.UpdateAll()
+		for k := range g.cells {
+			p := Vec2i{k % width, k / width}
+			if got, want := g.cells[k].distance_sq, want.cells[k].distance_sq; got != want {
+				t.Fatalf("map %d: distance at %v = %d, want %d\n%s", i, p, got, want, g)
+			}
+			changed := g.cells[k].space != before.cells[k].space || g.cells[k].terrain != before.cells[k].terrain
+			if changed && !(image.Point{p.X, p.Y}).In(dirty) {
+				t.Fatalf("map %d: %v changed outside of the dirty rectangle %v", i, p, dirty)
+			}
+		}
+		last := map[Vec2i]CellEdit{}
+		for _, edit := range edits {
+			last[edit.Pos] = edit
+		}
+		for p, edit := range last {
+			if got := g.Edit(p); got != edit {
+				t.Fatalf("map %d: cell is %+v, want %+v", i, got, edit)
+			}
+		}
+	}
+}
+
+func TestSetClosedDirtyRectangle(t *testing.T) {
+	g := New(64, 64)
+	if dirty := g.SetClosed(32, 32, false); !dirty.Empty() {
+		t.Errorf("dirty = %v for a cell that didn't change", dirty)
+	}
+	if dirty := g.SetClosed(-1, 0, true); !dirty.Empty() {
+		t.Errorf("dirty = %v for a cell outside of the grid", dirty)
+	}
+	g.SetClosed(30, 32, true)
+	// closing the cell next to an existing wall only affects the cells that are now closer to it.
+	dirty := g.SetClosed(31, 32, true)
+	if dirty.Empty() || dirty.Dx() >= 64 || dirty.Dy() >= 64 {
+		t.Errorf("dirty = %v", dirty)
+	}
+	if !(image.Point{31, 32}).In(dirty) {
+		t.Errorf("dirty = %v doesn't contain the toggled cell", dirty)
+	}
+}
+
+func BenchmarkSetClosed(b *testing.B) {
+	rng := rand.New(rand.NewSource(6))
+	g := random_grid(rng, 128, 128, 0.05)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := rng.Intn(128), rng.Intn(128)
+		g.SetClosed(x, y, !g.At(x, y).Closed())
+	}
+}
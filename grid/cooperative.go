@@ -0,0 +1,268 @@
+package grid
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"slices"
+)
+
+// Agent is one of the agents planned together by PlanAgents.
+type Agent struct {
+	Start Vec2i
+	Goal  Vec2i
+	// Size is the clearance the agent needs, like PathArgs.MinSpace. the agent takes up every cell closer than Size to
+	// its position, so agents of size 1 only take up their own cell.
+	Size int
+}
+
+// reservation is an agent taking up the cells within radius of pos.
+type reservation struct {
+	agent  int
+	pos    Vec2i
+	radius int
+}
+
+// reservation_table records where the agents planned so far will be. time is kept in half steps: an agent stands on
+// its cell at even times, and at the odd time between two steps it takes up both the cell it leaves and the one it
+// enters, so agents can't swap places or follow each other too closely.
+type reservation_table struct {
+	times [][]reservation
+}
+
+func (r *reservation_table) reserve(half, agent int, pos Vec2i, radius int) {
+	for len(r.times) <= half {
+		r.times = append(r.times, nil)
+	}
+	r.times[half] = append(r.times[half], reservation{agent, pos, radius})
+}
+
+// free reports whether agent may take up the cells within radius of pos at the given time.
+func (r *reservation_table) free(half, agent int, pos Vec2i, radius int) bool {
+	if half >= len(r.times) {
+		return true
+	}
+	for _, other := range r.times[half] {
+		if other.agent == agent {
+			continue
+		}
+		reach := radius + other.radius + 1
+		if pos.DistanceSq(other.pos) < reach*reach {
+			return false
+		}
+	}
+	return true
+}
+
+// reserve_path reserves path up to window steps. agents stay where their path ends, so the last cell is reserved for
+// the rest of the window.
+func (r *reservation_table) reserve_path(agent int, path []Vec2i, radius, window int) {
+	for t := 0; t <= window; t++ {
+		if t+1 < len(path) {
+			r.reserve(2*t, agent, path[t], radius)
+			if t < window {
+				r.reserve(2*t+1, agent, path[t], radius)
+				r.reserve(2*t+1, agent, path[t+1], radius)
+			}
+			continue
+		}
+		end := path[len(path)-1]
+		r.reserve(2*t, agent, end, radius)
+		if t < window {
+			r.reserve(2*t+1, agent, end, radius)
+		}
+	}
+}
+
+// PlanAgents plans paths for agents with windowed cooperative A*. agents are planned one at a time in order of
+// priority, and each one avoids the space and time reserved by those before it. every path has one position per step,
+// so a repeated position is a wait.
+//
+// only the first window steps are coordinated. past that, a path is the cheapest way to the goal ignoring the other
+// agents, and callers should replan before their agents get that far. agents that can't reach their goal stay where
+// they are, and are planned first so that everyone else goes around them. an agent that is boxed in by the ones before
+// it is moved to the front and everyone is planned again, but if that keeps happening the last agent to be boxed in
+// stays where it is regardless of the others.
+func (g *Grid) PlanAgents(agents []Agent, window int) [][]Vec2i {
+	return g.plan_agents(agents, window, nil)
+}
+
+// PlanAgentsContext is PlanAgents, but it gives up and returns nil once ctx is done.
+func (g *Grid) PlanAgentsContext(ctx context.Context, agents []Agent, window int) [][]Vec2i {
+	return g.plan_agents(agents, window, &limits{arg: &PathArgs{Context: ctx}})
+}
+
+// plan_agents is PlanAgents. every node its searches expand counts against l, and it returns nil when l stops it.
+func (g *Grid) plan_agents(agents []Agent, window int, l *limits) [][]Vec2i {
+	distances := make([][]float64, len(agents))
+	var order, moving []int
+	for i, agent := range agents {
+		if g.AtPos(agent.Start).Traversable(agent.Size) && g.InBounds(agent.Goal.X, agent.Goal.Y) {
+			// the distance to the goal ignoring the other agents is both the heuristic and how the path carries on
+			// after the window.
+			if distances[i] = g.costs_within(agent.Goal, agent.Size, g.Bounds(), l); distances[i] == nil {
+				return nil
+			}
+			if !math.IsInf(distances[i][agent.Start.X+(agent.Start.Y*g.width)], 1) {
+				moving = append(moving, i)
+				continue
+			}
+		}
+		order = append(order, i)
+	}
+	fixed := len(order)
+	order = append(order, moving...)
+
+	paths := make([][]Vec2i, len(agents))
+	for attempt := 0; attempt <= len(moving); attempt++ {
+		// every agent holds on to where it starts until halfway through the first step, so nobody plans to walk into
+		// an agent that hasn't been planned yet.
+		var table reservation_table
+		for i, agent := range agents {
+			table.reserve(0, i, agent.Start, agent.Size-1)
+			table.reserve(1, i, agent.Start, agent.Size-1)
+		}
+		boxed := -1
+		for n, i := range order {
+			var path []Vec2i
+			if n >= fixed {
+				path = g.plan_agent(i, agents[i], distances[i], window, &table, l)
+				if path == nil && l != nil && l.stop != PathFound {
+					return nil
+				}
+				if path == nil && boxed == -1 {
+					boxed = n
+				}
+			}
+			if path == nil {
+				path = []Vec2i{agents[i].Start}
+			}
+			table.reserve_path(i, path, agents[i].Size-1, window)
+			paths[i] = path
+		}
+		if boxed == -1 || boxed == fixed {
+			break
+		}
+		i := order[boxed]
+		copy(order[fixed+1:boxed+1], order[fixed:boxed])
+		order[fixed] = i
+	}
+	return paths
+}
+
+// plan_agent runs a space-time A* for agent against the reservations in table, with distance as the heuristic. the
+// search ends at the goal once the agent can stay there for the rest of the window, or at any cell at the end of the
+// window, from where the path carries on down distance. it returns nil if the agent is boxed in, or if l stops it.
+func (g *Grid) plan_agent(id int, agent Agent, distance []float64, window int, table *reservation_table, l *limits) []Vec2i {
+	index := func(p Vec2i) int {
+		return p.X + (p.Y * g.width)
+	}
+
+	area := g.width * g.height
+	radius := agent.Size - 1
+	key := func(p Vec2i, t int) int {
+		return index(p) + (t * area)
+	}
+	pos := func(key int) (Vec2i, int) {
+		i := key % area
+		return Vec2i{i % g.width, i / g.width}, key / area
+	}
+
+	// the goal is a place to stop only if nobody passes through it for the rest of the window.
+	can_stay := func(p Vec2i, t int) bool {
+		for half := 2 * t; half <= 2*window; half++ {
+			if !table.free(half, id, p, radius) {
+				return false
+			}
+		}
+		return true
+	}
+
+	cost := map[int]float64{}
+	prev := map[int]int{}
+	closed := map[int]bool{}
+
+	start := key(agent.Start, 0)
+	cost[start] = 0
+	var open node_queue
+	heap.Push(&open, node_entry{start, distance[index(agent.Start)], 0})
+
+	end := -1
+	for open.Len() > 0 {
+		entry := heap.Pop(&open).(node_entry)
+		if closed[entry.index] || entry.cost != cost[entry.index] {
+			continue
+		}
+		if _, ok := l.expand(); !ok {
+			return nil
+		}
+		closed[entry.index] = true
+		cur, t := pos(entry.index)
+
+		if t == window || (cur == agent.Goal && can_stay(cur, t)) {
+			end = entry.index
+			break
+		}
+
+		visit := func(next Vec2i, step float64) {
+			k := key(next, t+1)
+			if closed[k] {
+				return
+			}
+			if !table.free(2*t+1, id, cur, radius) || !table.free(2*t+1, id, next, radius) || !table.free(2*t+2, id, next, radius) {
+				return
+			}
+			next_cost := entry.cost + step
+			if c, ok := cost[k]; ok && next_cost >= c {
+				return
+			}
+			cost[k] = next_cost
+			prev[k] = entry.index
+			heap.Push(&open, node_entry{k, next_cost + distance[index(next)], next_cost})
+		}
+
+		// waiting costs as much as a step, except at the goal where the agent would be waiting anyway.
+		if cur == agent.Goal {
+			visit(cur, 0)
+		} else {
+			visit(cur, cardinal_cost)
+		}
+		for _, dir := range path_directions {
+			if g.can_step(cur, dir, agent.Size) {
+				next := cur.Add(dir.Vec2i())
+				visit(next, g.travel_cost(cur, next))
+			}
+		}
+	}
+	if end == -1 {
+		return nil
+	}
+
+	var path []Vec2i
+	for k := end; k != start; k = prev[k] {
+		p, _ := pos(k)
+		path = append(path, p)
+	}
+	path = append(path, agent.Start)
+	slices.Reverse(path)
+
+	// past the window, walk down the distance to the goal.
+	for cur := path[len(path)-1]; cur != agent.Goal; {
+		best, best_distance := cur, distance[index(cur)]
+		for _, dir := range path_directions {
+			if !g.can_step(cur, dir, agent.Size) {
+				continue
+			}
+			next := cur.Add(dir.Vec2i())
+			if d := distance[index(next)]; d < best_distance {
+				best, best_distance = next, d
+			}
+		}
+		if best == cur {
+			break
+		}
+		path = append(path, best)
+		cur = best
+	}
+	return path
+}
@@ -0,0 +1,141 @@
+package grid
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// check_agents verifies that every path is a valid walk and that no two agents overlap within the window, whether
+// standing or moving.
+func check_agents(t *testing.T, g *Grid, agents []Agent, paths [][]Vec2i, window int) {
+	t.Helper()
+	at := func(path []Vec2i, step int) Vec2i {
+		return path[min(step, len(path)-1)]
+	}
+	overlap := func(a Vec2i, a_size int, b Vec2i, b_size int) bool {
+		reach := a_size + b_size - 1
+		return a.DistanceSq(b) < reach*reach
+	}
+
+	for i, path := range paths {
+		if path[0] != agents[i].Start {
+			t.Fatalf("agent %d starts at %v, want %v", i, path[0], agents[i].Start)
+		}
+		for step := 1; step < len(path); step++ {
+			if path[step] != path[step-1] {
+				check_path(t, g, path[step-1:step+1], agents[i].Size)
+			}
+		}
+	}
+
+	for step := 0; step <= window; step++ {
+		for i := range agents {
+			for j := i + 1; j < len(agents); j++ {
+				a, b := agents[i], agents[j]
+				if overlap(at(paths[i], step), a.Size, at(paths[j], step), b.Size) {
+					t.Fatalf("agents %d and %d overlap at step %d: %v and %v", i, j, step, at(paths[i], step), at(paths[j], step))
+				}
+				if step == window {
+					continue
+				}
+				for _, p := range []Vec2i{at(paths[i], step), at(paths[i], step+1)} {
+					for _, q := range []Vec2i{at(paths[j], step), at(paths[j], step+1)} {
+						if overlap(p, a.Size, q, b.Size) {
+							t.Fatalf("agents %d and %d run into each other between steps %d and %d", i, j, step, step+1)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPlanAgentsSwap(t *testing.T) {
+	g := parse(
+		".........",
+		"######.##",
+	)
+	agents := []Agent{
+		{Start: Vec2i{0, 0}, Goal: Vec2i{8, 0}, Size: 1},
+		{Start: Vec2i{8, 0}, Goal: Vec2i{0, 0}, Size: 1},
+	}
+	paths := g.PlanAgents(agents, 32)
+	check_agents(t, g, agents, paths, 32)
+	for i, path := range paths {
+		if end := path[len(path)-1]; end != agents[i].Goal {
+			t.Errorf("agent %d ends at %v, want %v", i, end, agents[i].Goal)
+		}
+	}
+	// the second agent has to step into the gap to let the other by.
+	if len(paths[1]) <= 9 {
+		t.Errorf("agent 1 didn't give way: %v, %v", paths[0], paths[1])
+	}
+}
+
+func TestPlanAgentsStayAtGoal(t *testing.T) {
+	g := New(8, 3)
+	agents := []Agent{
+		{Start: Vec2i{0, 1}, Goal: Vec2i{7, 1}, Size: 1},
+		// already at its goal, but in the way.
+		{Start: Vec2i{3, 1}, Goal: Vec2i{3, 1}, Size: 1},
+	}
+	paths := g.PlanAgents(agents, 16)
+	check_agents(t, g, agents, paths, 16)
+	if end := paths[1][len(paths[1])-1]; end != agents[1].Goal {
+		t.Errorf("agent 1 ends at %v, want to return to %v", end, agents[1].Goal)
+	}
+}
+
+func TestPlanAgentsCancelled(t *testing.T) {
+	g := New(64, 64)
+	agents := []Agent{
+		{Start: Vec2i{0, 0}, Goal: Vec2i{63, 63}, Size: 1},
+		{Start: Vec2i{63, 63}, Goal: Vec2i{0, 0}, Size: 1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if paths := g.PlanAgentsContext(ctx, agents, 16); len(paths) != len(agents) {
+		t.Fatalf("planned %d agents, want %d", len(paths), len(agents))
+	}
+	cancel()
+	if paths := g.PlanAgentsContext(ctx, agents, 16); paths != nil {
+		t.Errorf("planned %v with a cancelled context", paths)
+	}
+}
+
+func TestPlanAgents(t *testing.T) {
+	rng := rand.New(rand.NewSource(13))
+	const window = 24
+	for i := 0; i < 50; i++ {
+		g := random_grid(rng, 24, 24, 0.15)
+
+		// starts and goals must be clear of each other, or the agents overlap before they move.
+		var agents []Agent
+		clear_of := func(p Vec2i, size int, field func(Agent) Vec2i) bool {
+			if !g.AtPos(p).Traversable(size) {
+				return false
+			}
+			for _, other := range agents {
+				reach := size + other.Size - 1
+				if p.DistanceSq(field(other)) < reach*reach {
+					return false
+				}
+			}
+			return true
+		}
+		for tries := 0; len(agents) < 8 && tries < 1000; tries++ {
+			size := 1 + rng.Intn(2)
+			start := Vec2i{rng.Intn(24), rng.Intn(24)}
+			goal := Vec2i{rng.Intn(24), rng.Intn(24)}
+			if clear_of(start, size, func(a Agent) Vec2i { return a.Start }) && clear_of(goal, size, func(a Agent) Vec2i { return a.Goal }) {
+				agents = append(agents, Agent{start, goal, size})
+			}
+		}
+
+		paths := g.PlanAgents(agents, window)
+		if len(paths) != len(agents) {
+			t.Fatalf("map %d: %d paths for %d agents", i, len(paths), len(agents))
+		}
+		check_agents(t, g, agents, paths, window)
+	}
+}
@@ -0,0 +1,62 @@
+package grid
+
+type Direction int
+
+const (
+	Northwest Direction = iota
+	North
+	Northeast
+	East
+	Southeast
+	South
+	Southwest
+	West
+)
+
+// path_directions is the order in which neighbours are expanded during a search. cardinal directions come first so
+// that ties prefer straight steps.
+var path_directions = [...]Direction{
+	North,
+	East,
+	South,
+	West,
+	Northwest,
+	Northeast,
+	Southeast,
+	Southwest,
+}
+
+func (d Direction) Vec2i() Vec2i {
+	switch d {
+	case Northwest:
+		return Vec2i{-1, -1}
+	case North:
+		return Vec2i{0, -1}
+	case Northeast:
+		return Vec2i{1, -1}
+	case East:
+		return Vec2i{1, 0}
+	case Southeast:
+		return Vec2i{1, 1}
+	case South:
+		return Vec2i{0, 1}
+	case Southwest:
+		return Vec2i{-1, 1}
+	case West:
+		return Vec2i{-1, 0}
+	default:
+		return Vec2i{0, 0}
+	}
+}
+
+func (d Direction) RotateCCW() Direction {
+	return (d + 7) & 0b111
+}
+
+func (d Direction) RotateCW() Direction {
+	return (d + 1) & 0b111
+}
+
+func (d Direction) Diagonal() bool {
+	return d&1 == 0
+}
@@ -0,0 +1,168 @@
+package grid
+
+import (
+	"image"
+	"math"
+)
+
+// max_flow_fields is how many flow fields a FlowCache holds on to before it starts dropping the oldest.
+const max_flow_fields = 16
+
+// FlowField holds the way to a single goal from every cell, so any number of agents heading there can share one
+// search. it's built with a single reverse dijkstra from the goal.
+type FlowField struct {
+	goal      Vec2i
+	min_space int
+	width     int
+	// cost is the integration cost to the goal from every cell, or +Inf.
+	cost []float64
+	// directions is the step to take from every cell, or -1 at the goal and where it can't be reached.
+	directions []Direction
+}
+
+// FlowField returns the flow field towards goal for agents with min_space clearance.
+func (g *Grid) FlowField(goal Vec2i, min_space int) *FlowField {
+	f := &FlowField{
+		goal:       goal,
+		min_space:  min_space,
+		width:      g.width,
+		directions: make([]Direction, len(g.cells)),
+	}
+	for i := range f.directions {
+		f.directions[i] = -1
+	}
+	if !g.AtPos(goal).Traversable(min_space) {
+		f.cost = make([]float64, len(g.cells))
+		for i := range f.cost {
+			f.cost[i] = math.Inf(1)
+		}
+		return f
+	}
+
+	// steps are symmetric, so the cost from the goal to every cell is also the cost from every cell to the goal.
+	// agents may step out of a cell that is too tight for them, like the start of a path, so those cells take the
+	// cheapest step into one of their neighbours.
+	f.cost = g.costs_within(goal, min_space, g.Bounds(), nil)
+	for i := range f.cost {
+		cur := Vec2i{i % g.width, i / g.width}
+		if cur == goal {
+			continue
+		}
+		best := math.Inf(1)
+		for _, dir := range path_directions {
+			if !g.can_step(cur, dir, min_space) {
+				continue
+			}
+			next := cur.Add(dir.Vec2i())
+			if c := f.cost[next.X+(next.Y*g.width)] + g.travel_cost(cur, next); c < best {
+				best = c
+				f.directions[i] = dir
+			}
+		}
+		// a cell that can't be stepped into only depends on its neighbours that can, so updating it in place doesn't
+		// affect the cells after it.
+		f.cost[i] = min(f.cost[i], best)
+	}
+	return f
+}
+
+func (f *FlowField) Goal() Vec2i {
+	return f.goal
+}
+
+func (f *FlowField) MinSpace() int {
+	return f.min_space
+}
+
+func (f *FlowField) in(p Vec2i) bool {
+	return p.X >= 0 && p.Y >= 0 && p.X < f.width && p.X+(p.Y*f.width) < len(f.cost)
+}
+
+// Direction returns the step to take from p towards the goal. it's false at the goal and wherever the goal can't be
+// reached from.
+func (f *FlowField) Direction(p Vec2i) (Direction, bool) {
+	if !f.in(p) {
+		return -1, false
+	}
+	dir := f.directions[p.X+(p.Y*f.width)]
+	return dir, dir != -1
+}
+
+// Cost returns the cost of the cheapest path from p to the goal, or +Inf if there is none.
+func (f *FlowField) Cost(p Vec2i) float64 {
+	if !f.in(p) {
+		return math.Inf(1)
+	}
+	return f.cost[p.X+(p.Y*f.width)]
+}
+
+type flow_key struct {
+	goal      Vec2i
+	min_space int
+}
+
+// FlowCache keeps the flow fields of a grid around until the cells they depend on change. pass the rectangle returned
+// by Grid.SetClosed to Invalidate after every edit.
+type FlowCache struct {
+	g      *Grid
+	fields map[flow_key]*FlowField
+	// order holds the keys from oldest to newest.
+	order []flow_key
+}
+
+// NewFlowCache returns an empty cache over g. it holds onto g, so the grid must not be resized while it's in use.
+func NewFlowCache(g *Grid) *FlowCache {
+	return &FlowCache{
+		g:      g,
+		fields: make(map[flow_key]*FlowField),
+	}
+}
+
+// Get returns the flow field towards goal for agents with min_space clearance, building it if it isn't cached.
+func (c *FlowCache) Get(goal Vec2i, min_space int) *FlowField {
+	key := flow_key{goal, min_space}
+	if f, ok := c.fields[key]; ok {
+		return f
+	}
+	if len(c.order) >= max_flow_fields {
+		delete(c.fields, c.order[0])
+		c.order = c.order[1:]
+	}
+	f := c.g.FlowField(goal, min_space)
+	c.fields[key] = f
+	c.order = append(c.order, key)
+	return f
+}
+
+// Invalidate drops the flow fields that the cells within r could have changed. a field only depends on the cells its
+// agents can reach and the ones right next to them, so edits far away from any of them keep it.
+func (c *FlowCache) Invalidate(r image.Rectangle) {
+	r = r.Inset(-1).Intersect(c.g.Bounds())
+	if r.Empty() {
+		return
+	}
+	kept := c.order[:0]
+	for _, key := range c.order {
+		if c.fields[key].touches(r) {
+			delete(c.fields, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	c.order = kept
+}
+
+// touches reports whether the goal can be reached from any cell within r.
+func (f *FlowField) touches(r image.Rectangle) bool {
+	if f.goal.in(r) {
+		return true
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if !math.IsInf(f.cost[x+(y*f.width)], 1) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package grid
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFlowField(t *testing.T) {
+	rng := rand.New(rand.NewSource(14))
+	for i := 0; i < 50; i++ {
+		g := random_grid(rng, 24, 24, 0.3)
+		goal := Vec2i{rng.Intn(24), rng.Intn(24)}
+		min_space := 1 + rng.Intn(2)
+		f := g.FlowField(goal, min_space)
+
+		for j := 0; j < 20; j++ {
+			start := Vec2i{rng.Intn(24), rng.Intn(24)}
+			if start == goal {
+				continue
+			}
+			want := dijkstra_cost(g, start, goal, min_space)
+			if want < 0 {
+				if !math.IsInf(f.Cost(start), 1) {
+					t.Fatalf("map %d: cost from unreachable %v = %f", i, start, f.Cost(start))
+				}
+				if _, ok := f.Direction(start); ok {
+					t.Fatalf("map %d: unreachable %v has a direction", i, start)
+				}
+				continue
+			}
+			if math.Abs(f.Cost(start)-want) > 1e-9 {
+				t.Fatalf("map %d: cost from %v = %f, want %f", i, start, f.Cost(start), want)
+			}
+
+			// following the directions is a cheapest path.
+			path := []Vec2i{start}
+			for cur := start; cur != goal; {
+				dir, ok := f.Direction(cur)
+				if !ok {
+					t.Fatalf("map %d: no direction at %v on the way from %v", i, cur, start)
+				}
+				cur = cur.Add(dir.Vec2i())
+				path = append(path, cur)
+			}
+			check_path(t, g, path, min_space)
+			if got := PathLength(path); math.Abs(got-want) > 1e-9 {
+				t.Fatalf("map %d: path cost from %v = %f, want %f", i, start, got, want)
+			}
+		}
+	}
+}
+
+func TestFlowFieldClosedGoal(t *testing.T) {
+	g := parse(
+		"....",
+		".#..",
+		"....",
+	)
+	f := g.FlowField(Vec2i{1, 1}, 1)
+	if _, ok := f.Direction(Vec2i{0, 0}); ok {
+		t.Error("direction towards a closed goal")
+	}
+	if _, ok := f.Direction(Vec2i{-1, 0}); ok {
+		t.Error("direction out of bounds")
+	}
+}
+
+func TestFlowCache(t *testing.T) {
+	g := parse(
+		"........#.......",
+		"........#.......",
+		"........#.......",
+		"........#.......",
+	)
+	c := NewFlowCache(g)
+	left := c.Get(Vec2i{0, 0}, 1)
+	right := c.Get(Vec2i{15, 0}, 1)
+	if c.Get(Vec2i{0, 0}, 1) != left {
+		t.Error("flow field wasn't cached")
+	}
+	if c.Get(Vec2i{0, 0}, 2) == left {
+		t.Error("flow fields of different clearances are shared")
+	}
+
+	// the right side can't be reached from the left, so editing it keeps the left field.
+	c.Invalidate(g.SetClosed(13, 2, true))
+	if c.Get(Vec2i{0, 0}, 1) != left {
+		t.Error("left field was dropped by an edit it can't see")
+	}
+	got := c.Get(Vec2i{15, 0}, 1)
+	if got == right {
+		t.Fatal("right field wasn't dropped")
+	}
+	if want := g.FlowField(Vec2i{15, 0}, 1); !reflect.DeepEqual(got, want) {
+		t.Error("rebuilt field doesn't match a fresh one")
+	}
+
+	// opening the wall joins both sides.
+	c.Invalidate(g.SetClosed(8, 3, false))
+	if c.Get(Vec2i{0, 0}, 1) == left {
+		t.Error("left field wasn't dropped after the wall opened")
+	}
+}
@@ -0,0 +1,231 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Map files are little endian and laid out as a fixed header, a list of sections and a checksum:
+//
+//	offset  size  field
+//	0       4     magic, "DFMP"
+//	4       2     version
+//	6       2     header size in bytes, counted from the start of the file
+//	8       4     file size in bytes, including the checksum
+//	12      4     width in cells
+//	16      4     height in cells
+//	20      2     tile size in cells
+//	22      2     flags, reserved and written as 0
+//
+// the header is followed by sections up to the checksum. each section is a 4 byte tag, a 4 byte payload size and the
+// payload. the file ends with the CRC-32 (IEEE) of everything before it.
+//
+//	tag     payload
+//	"TILE"  one ClosedCells bitmask per tile as a uint64, row by row. bits for cells past the edge of the grid are set.
+//	"SCNE"  optional, the Scene the map was saved with.
+//	"TERR"  optional, the Terrain of every cell as a byte, row by row. maps without it are all road.
+//
+// readers skip header bytes and sections they don't know, so fields and sections can be added without breaking older
+// readers. the version only changes when the existing layout does, and readers refuse versions newer than their own.
+const (
+	map_magic       = "DFMP"
+	map_version     = 1
+	map_header_size = 24
+	map_crc_size    = 4
+)
+
+var (
+	ErrNotMap             = errors.New("grid: not a map file")
+	ErrUnsupportedVersion = errors.New("grid: unsupported map version")
+	ErrTruncated          = errors.New("grid: map file is truncated")
+	ErrChecksum           = errors.New("grid: map checksum mismatch")
+	ErrDimensions         = errors.New("grid: map dimensions don't match")
+	ErrCorrupt            = errors.New("grid: map file is corrupt")
+)
+
+var (
+	section_tiles   = [4]byte{'T', 'I', 'L', 'E'}
+	section_terrain = [4]byte{'T', 'E', 'R', 'R'}
+)
+
+type map_header struct {
+	Magic      [4]byte
+	Version    uint16
+	HeaderSize uint16
+	FileSize   uint32
+	Width      uint32
+	Height     uint32
+	TileSize   uint16
+	Flags      uint16
+}
+
+type section_header struct {
+	Tag  [4]byte
+	Size uint32
+}
+
+// Save writes g to w as a map file without a scene.
+func (g *Grid) Save(w io.Writer) error {
+	return Encode(w, g, nil)
+}
+
+// Encode writes g and scene to w as a map file. scene may be nil.
+func Encode(w io.Writer, g *Grid, scene *Scene) error {
+	tiles := g.Tiles()
+
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, section_header{section_tiles, uint32(len(tiles) * 8)})
+	for _, tile := range tiles {
+		binary.Write(&body, binary.LittleEndian, tile.ClosedCells)
+	}
+	if scene != nil {
+		payload := scene.marshal()
+		binary.Write(&body, binary.LittleEndian, section_header{section_scene, uint32(len(payload))})
+		body.Write(payload)
+	}
+	if !g.uniform_terrain() {
+		binary.Write(&body, binary.LittleEndian, section_header{section_terrain, uint32(len(g.cells))})
+		for i := range g.cells {
+			body.WriteByte(byte(g.cells[i].terrain))
+		}
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, map_header{
+		Magic:      [4]byte([]byte(map_magic)),
+		Version:    map_version,
+		HeaderSize: map_header_size,
+		FileSize:   uint32(map_header_size + body.Len() + map_crc_size),
+		Width:      uint32(g.width),
+		Height:     uint32(g.height),
+		TileSize:   TileSize,
+	})
+	buf.Write(body.Bytes())
+	binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Decode reads a map file into a new grid of the size stored in the file. the scene is nil when the file has none.
+func Decode(r io.Reader) (*Grid, *Scene, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, sections, err := parse_map(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	width, height := int(header.Width), int(header.Height)
+	tiles_x := (width + TileSize - 1) / TileSize
+	tiles_y := (height + TileSize - 1) / TileSize
+	payload, ok := sections[section_tiles]
+	if !ok || len(payload) != tiles_x*tiles_y*8 {
+		return nil, nil, fmt.Errorf("%w: expected %d tiles", ErrCorrupt, tiles_x*tiles_y)
+	}
+
+	var scene *Scene
+	if payload, ok := sections[section_scene]; ok {
+		scene = new(Scene)
+		if err := scene.unmarshal(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	g := New(width, height)
+	tiles := make([]TileData, 0, tiles_x*tiles_y)
+	for tile_y := 0; tile_y < tiles_y; tile_y++ {
+		for tile_x := 0; tile_x < tiles_x; tile_x++ {
+			tiles = append(tiles, TileData{
+				X:           tile_x,
+				Y:           tile_y,
+				ClosedCells: binary.LittleEndian.Uint64(payload[len(tiles)*8:]),
+			})
+		}
+	}
+	if err := g.SetTiles(tiles); err != nil {
+		return nil, nil, err
+	}
+	if payload, ok := sections[section_terrain]; ok {
+		if len(payload) != len(g.cells) {
+			return nil, nil, fmt.Errorf("%w: expected %d terrain cells", ErrCorrupt, len(g.cells))
+		}
+		for i, terrain := range payload {
+			if Terrain(terrain) >= TerrainCount {
+				return nil, nil, fmt.Errorf("%w: unknown terrain %d", ErrCorrupt, terrain)
+			}
+			g.cells[i].terrain = Terrain(terrain)
+		}
+	}
+	return g, scene, nil
+}
+
+// Load reads a map file into g, which must be the same size as the stored map, and returns the scene stored with it
+// if there is one. g is left untouched on error.
+func (g *Grid) Load(r io.Reader) (*Scene, error) {
+	loaded, scene, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if loaded.width != g.width || loaded.height != g.height {
+		return nil, fmt.Errorf("%w: file is %dx%d, grid is %dx%d", ErrDimensions, loaded.width, loaded.height, g.width, g.height)
+	}
+	copy(g.cells, loaded.cells)
+	g.clear_caches()
+	return scene, nil
+}
+
+// parse_map validates the framing of a map file and returns its header and the payload of every section by tag.
+func parse_map(data []byte) (header map_header, sections map[[4]byte][]byte, err error) {
+	if len(data) < 4 || string(data[:4]) != map_magic {
+		return header, nil, ErrNotMap
+	}
+	if len(data) < map_header_size {
+		return header, nil, ErrTruncated
+	}
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &header)
+
+	if header.Version > map_version {
+		return header, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.Version)
+	}
+	if int(header.FileSize) > len(data) {
+		return header, nil, ErrTruncated
+	}
+	if header.HeaderSize < map_header_size || int(header.HeaderSize)+map_crc_size > int(header.FileSize) {
+		return header, nil, fmt.Errorf("%w: bad header size %d", ErrCorrupt, header.HeaderSize)
+	}
+	data = data[:header.FileSize]
+	body, sum := data[:len(data)-map_crc_size], data[len(data)-map_crc_size:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum) {
+		return header, nil, ErrChecksum
+	}
+	if header.TileSize != TileSize {
+		return header, nil, fmt.Errorf("%w: tile size %d", ErrDimensions, header.TileSize)
+	}
+	if header.Width == 0 || header.Height == 0 {
+		return header, nil, fmt.Errorf("%w: %dx%d", ErrDimensions, header.Width, header.Height)
+	}
+
+	sections = make(map[[4]byte][]byte)
+	body = body[header.HeaderSize:]
+	for len(body) > 0 {
+		if len(body) < 8 {
+			return header, nil, fmt.Errorf("%w: section header overruns the file", ErrCorrupt)
+		}
+		var section section_header
+		binary.Read(bytes.NewReader(body), binary.LittleEndian, &section)
+		body = body[8:]
+		if uint64(section.Size) > uint64(len(body)) {
+			return header, nil, fmt.Errorf("%w: section %q overruns the file", ErrCorrupt, section.Tag[:])
+		}
+		sections[section.Tag] = body[:section.Size]
+		body = body[section.Size:]
+	}
+	return header, sections, nil
+}
@@ -0,0 +1,198 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func save(t *testing.T, g *Grid) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := g.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// reseal fixes up the file size and checksum of a map file after it was modified.
+func reseal(data []byte) []byte {
+	data = data[:len(data)-map_crc_size]
+	binary.LittleEndian.PutUint32(data[8:], uint32(len(data)+map_crc_size))
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(14))
+	g := random_grid(rng, 21, 13, 0.4)
+	loaded, _, err := Decode(bytes.NewReader(save(t, g)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Width() != 21 || loaded.Height() != 13 {
+		t.Fatalf("loaded grid is %dx%d", loaded.Width(), loaded.Height())
+	}
+	if got, want := loaded.String(), g.String(); got != want {
+		t.Errorf("loaded grid differs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	rng := rand.New(rand.NewSource(15))
+	data := save(t, random_grid(rng, 16, 16, 0.4))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotMap},
+		{"gob", []byte{0x0c, 0xff, 0x81, 0x02, 0x01}, ErrNotMap},
+		{"header", data[:10], ErrTruncated},
+		{"body", data[:len(data)-1], ErrTruncated},
+		{"checksum", func() []byte {
+			data := bytes.Clone(data)
+			data[map_header_size+10] ^= 1
+			return data
+		}(), ErrChecksum},
+		{"version", func() []byte {
+			data := bytes.Clone(data)
+			binary.LittleEndian.PutUint16(data[4:], map_version+1)
+			return reseal(data)
+		}(), ErrUnsupportedVersion},
+		{"tile size", func() []byte {
+			data := bytes.Clone(data)
+			binary.LittleEndian.PutUint16(data[20:], 16)
+			return reseal(data)
+		}(), ErrDimensions},
+		{"section size", func() []byte {
+			data := bytes.Clone(data)
+			binary.LittleEndian.PutUint32(data[map_header_size+4:], 1<<20)
+			return reseal(data)
+		}(), ErrCorrupt},
+		{"tile count", func() []byte {
+			data := bytes.Clone(data)
+			binary.LittleEndian.PutUint32(data[12:], 32)
+			return reseal(data)
+		}(), ErrCorrupt},
+	}
+	for _, test := range tests {
+		if _, _, err := Decode(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	rng := rand.New(rand.NewSource(16))
+	g := random_grid(rng, 16, 16, 0.4)
+	data := save(t, g)
+
+	// a future writer with a longer header and a section this reader doesn't know about.
+	var future []byte
+	future = append(future, data[:map_header_size]...)
+	binary.LittleEndian.PutUint16(future[6:], map_header_size+4)
+	future = append(future, 1, 2, 3, 4)
+	future = append(future, 'X', 'T', 'R', 'A', 3, 0, 0, 0, 7, 8, 9)
+	future = append(future, data[map_header_size:]...)
+
+	loaded, _, err := Decode(bytes.NewReader(reseal(future)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.String(), g.String(); got != want {
+		t.Errorf("loaded grid differs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLoadDimensionMismatch(t *testing.T) {
+	data := save(t, New(16, 16))
+	g := New(24, 16)
+	g.SetClosed(3, 3, true)
+	if _, err := g.Load(bytes.NewReader(data)); !errors.Is(err, ErrDimensions) {
+		t.Errorf("err = %v, want %v", err, ErrDimensions)
+	}
+	if !g.At(3, 3).Closed() {
+		t.Error("grid was modified by a rejected load")
+	}
+}
+
+func TestSceneRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	g := random_grid(rng, 32, 32, 0.2)
+	scene := &Scene{
+		Player:          Vec2i{3, 4},
+		Goal:            Vec2i{-1, 30},
+		PlayerSize:      2,
+		MaxReach:        12,
+		MaxDistance:     40,
+		Search:          SearchJPS,
+		ClearanceWeight: 2.5,
+		MaxExpanded:     5000,
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, g, scene); err != nil {
+		t.Fatal(err)
+	}
+	loaded, loaded_scene, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded_scene == nil || *loaded_scene != *scene {
+		t.Fatalf("scene = %+v, want %+v", loaded_scene, scene)
+	}
+
+	want, want_ok := g.FindPath(scene.PathArgs())
+	got, got_ok := loaded.FindPath(loaded_scene.PathArgs())
+	if got_ok != want_ok || !slices.Equal(got, want) {
+		t.Errorf("replayed path = %v, %v, want %v, %v", got, got_ok, want, want_ok)
+	}
+}
+
+func TestSceneWithoutAppendedFields(t *testing.T) {
+	scene := Scene{Player: Vec2i{1, 2}, Goal: Vec2i{3, 4}, PlayerSize: 1, Search: "A*", ClearanceWeight: 3, MaxExpanded: 100}
+	data := scene.marshal()
+	var loaded Scene
+	if err := loaded.unmarshal(data[:len(data)-8-4]); err != nil {
+		t.Fatal(err)
+	}
+	scene.ClearanceWeight, scene.MaxExpanded = 0, 0
+	if loaded != scene {
+		t.Errorf("scene = %+v, want %+v", loaded, scene)
+	}
+}
+
+func TestDecodeWithoutScene(t *testing.T) {
+	if _, scene, err := Decode(bytes.NewReader(save(t, New(8, 8)))); err != nil || scene != nil {
+		t.Errorf("scene = %v, err = %v, want neither", scene, err)
+	}
+}
+
+func TestTerrainRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(16))
+	g := random_grid(rng, 19, 11, 0.2)
+	for i := 0; i < 80; i++ {
+		g.SetTerrain(rng.Intn(19), rng.Intn(11), Terrain(rng.Intn(int(TerrainCount))))
+	}
+	loaded, _, err := Decode(bytes.NewReader(save(t, g)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 19; x++ {
+			if got, want := loaded.At(x, y).Terrain(), g.At(x, y).Terrain(); got != want {
+				t.Errorf("terrain at %d,%d = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	// maps that are all road don't store their terrain.
+	if plain := save(t, New(8, 8)); bytes.Contains(plain, section_terrain[:]) {
+		t.Error("terrain section written for a grid of roads")
+	}
+}
@@ -0,0 +1,193 @@
+package grid
+
+import (
+	"image"
+	"math/rand/v2"
+)
+
+// the generators replace every cell of the grid, leaving the terrain alone. they're deterministic for a given seed and
+// grid size.
+
+func new_rand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+}
+
+// set_all closes the cells for which closed returns true and opens the rest, then recomputes the clearance.
+func (g *Grid) set_all(closed func(x, y int) bool) {
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			g.cells[x+(y*g.width)].closed = closed(x, y)
+		}
+	}
+	g.UpdateAll()
+}
+
+// GenerateScatter closes every cell with probability density.
+func (g *Grid) GenerateScatter(seed uint64, density float64) {
+	rng := new_rand(seed)
+	g.set_all(func(x, y int) bool {
+		return rng.Float64() < density
+	})
+}
+
+// GenerateCaves grows caves with a cellular automaton. every cell starts closed with probability fill, and then for
+// steps rounds a cell is closed when at least 5 of the 9 cells around and including it are. cells past the edge count
+// as closed, so the caves are walled in.
+func (g *Grid) GenerateCaves(seed uint64, fill float64, steps int) {
+	rng := new_rand(seed)
+	closed := make([]bool, len(g.cells))
+	for i := range closed {
+		closed[i] = rng.Float64() < fill
+	}
+	next := make([]bool, len(g.cells))
+	for range steps {
+		for y := 0; y < g.height; y++ {
+			for x := 0; x < g.width; x++ {
+				count := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if !g.InBounds(x+dx, y+dy) || closed[(x+dx)+((y+dy)*g.width)] {
+							count++
+						}
+					}
+				}
+				next[x+(y*g.width)] = count >= 5
+			}
+		}
+		closed, next = next, closed
+	}
+	g.set_all(func(x, y int) bool {
+		return closed[x+(y*g.width)]
+	})
+}
+
+// GenerateMaze carves a maze with a recursive backtracker. its corridors are corridor cells wide with walls of a
+// single cell between them, and there's exactly one way between any two places in it. whatever is left over at the
+// right and bottom edges stays closed.
+func (g *Grid) GenerateMaze(seed uint64, corridor int) {
+	rng := new_rand(seed)
+	corridor = max(corridor, 1)
+	pitch := corridor + 1
+	rooms_x := (g.width + 1) / pitch
+	rooms_y := (g.height + 1) / pitch
+
+	open := make([]bool, len(g.cells))
+	carve := func(r image.Rectangle) {
+		r = r.Intersect(g.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				open[x+(y*g.width)] = true
+			}
+		}
+	}
+	room := func(p Vec2i) image.Rectangle {
+		return image.Rect(p.X*pitch, p.Y*pitch, p.X*pitch+corridor, p.Y*pitch+corridor)
+	}
+
+	if rooms_x > 0 && rooms_y > 0 {
+		visited := make([]bool, rooms_x*rooms_y)
+		start := Vec2i{rng.IntN(rooms_x), rng.IntN(rooms_y)}
+		visited[start.X+(start.Y*rooms_x)] = true
+		carve(room(start))
+		stack := []Vec2i{start}
+		steps := []Vec2i{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			var unvisited []Vec2i
+			for _, step := range steps {
+				next := cur.Add(step)
+				if next.X >= 0 && next.Y >= 0 && next.X < rooms_x && next.Y < rooms_y && !visited[next.X+(next.Y*rooms_x)] {
+					unvisited = append(unvisited, next)
+				}
+			}
+			if len(unvisited) == 0 {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			next := unvisited[rng.IntN(len(unvisited))]
+			visited[next.X+(next.Y*rooms_x)] = true
+			// the room and the wall between them.
+			carve(room(cur).Union(room(next)))
+			stack = append(stack, next)
+		}
+	}
+	g.set_all(func(x, y int) bool {
+		return !open[x+(y*g.width)]
+	})
+}
+
+// GenerateRooms lays out rooms and corridors by binary space partitioning. the grid is split in two over and over
+// until the parts are too small to split again, every part gets a room of at least min_room cells on a side where it
+// fits, and the halves of every split are joined by a corridor between a room on either side.
+func (g *Grid) GenerateRooms(seed uint64, min_room int) {
+	rng := new_rand(seed)
+	min_room = max(min_room, 1)
+	// a part holds its room and a wall on every side.
+	min_part := min_room + 2
+
+	open := make([]bool, len(g.cells))
+	carve := func(r image.Rectangle) {
+		r = r.Intersect(g.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				open[x+(y*g.width)] = true
+			}
+		}
+	}
+	// between returns a random number in [lo, hi].
+	between := func(lo, hi int) int {
+		if hi <= lo {
+			return lo
+		}
+		return lo + rng.IntN(hi-lo+1)
+	}
+	center := func(r image.Rectangle) Vec2i {
+		return Vec2i{(r.Min.X + r.Max.X - 1) / 2, (r.Min.Y + r.Max.Y - 1) / 2}
+	}
+
+	// split returns the rooms within part.
+	var split func(part image.Rectangle) []image.Rectangle
+	split = func(part image.Rectangle) []image.Rectangle {
+		vertical := part.Dx() >= 2*min_part && (part.Dx() >= part.Dy() || part.Dy() < 2*min_part)
+		horizontal := !vertical && part.Dy() >= 2*min_part
+		if !vertical && !horizontal {
+			w := between(min(min_room, part.Dx()-2), part.Dx()-2)
+			h := between(min(min_room, part.Dy()-2), part.Dy()-2)
+			if w <= 0 || h <= 0 {
+				return nil
+			}
+			x := between(part.Min.X+1, part.Max.X-1-w)
+			y := between(part.Min.Y+1, part.Max.Y-1-h)
+			room := image.Rect(x, y, x+w, y+h)
+			carve(room)
+			return []image.Rectangle{room}
+		}
+
+		var a, b image.Rectangle
+		if vertical {
+			at := between(part.Min.X+min_part, part.Max.X-min_part)
+			a, b = image.Rect(part.Min.X, part.Min.Y, at, part.Max.Y), image.Rect(at, part.Min.Y, part.Max.X, part.Max.Y)
+		} else {
+			at := between(part.Min.Y+min_part, part.Max.Y-min_part)
+			a, b = image.Rect(part.Min.X, part.Min.Y, part.Max.X, at), image.Rect(part.Min.X, at, part.Max.X, part.Max.Y)
+		}
+		rooms_a, rooms_b := split(a), split(b)
+		if len(rooms_a) > 0 && len(rooms_b) > 0 {
+			from := center(rooms_a[rng.IntN(len(rooms_a))])
+			to := center(rooms_b[rng.IntN(len(rooms_b))])
+			// an L-shaped corridor, bending at either corner.
+			bend := Vec2i{to.X, from.Y}
+			if rng.IntN(2) == 0 {
+				bend = Vec2i{from.X, to.Y}
+			}
+			carve(image.Rect(min(from.X, bend.X), min(from.Y, bend.Y), max(from.X, bend.X)+1, max(from.Y, bend.Y)+1))
+			carve(image.Rect(min(bend.X, to.X), min(bend.Y, to.Y), max(bend.X, to.X)+1, max(bend.Y, to.Y)+1))
+		}
+		return append(rooms_a, rooms_b...)
+	}
+	split(g.Bounds())
+
+	g.set_all(func(x, y int) bool {
+		return !open[x+(y*g.width)]
+	})
+}
@@ -0,0 +1,89 @@
+package grid
+
+import (
+	"slices"
+	"testing"
+)
+
+// open_regions counts the groups of open cells that are connected by cardinal steps.
+func open_regions(g *Grid) (regions, open int) {
+	seen := make([]bool, len(g.cells))
+	for i := range g.cells {
+		if g.cells[i].closed || seen[i] {
+			continue
+		}
+		regions++
+		seen[i] = true
+		stack := []Vec2i{{i % g.width, i / g.width}}
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			open++
+			for _, dir := range []Direction{North, East, South, West} {
+				next := cur.Add(dir.Vec2i())
+				if cell := g.AtPos(next); cell != nil && !cell.closed && !seen[next.X+(next.Y*g.width)] {
+					seen[next.X+(next.Y*g.width)] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestGeneratorsAreSeeded(t *testing.T) {
+	generators := map[string]func(g *Grid, seed uint64){
+		"scatter": func(g *Grid, seed uint64) { g.GenerateScatter(seed, 0.3) },
+		"caves":   func(g *Grid, seed uint64) { g.GenerateCaves(seed, 0.45, 4) },
+		"maze":    func(g *Grid, seed uint64) { g.GenerateMaze(seed, 2) },
+		"rooms":   func(g *Grid, seed uint64) { g.GenerateRooms(seed, 4) },
+	}
+	for name, generate := range generators {
+		a, b, c := New(48, 40), New(48, 40), New(48, 40)
+		generate(a, 1)
+		generate(b, 1)
+		generate(c, 2)
+		if a.String() != b.String() {
+			t.Errorf("%s: the same seed made different maps", name)
+		}
+		if a.String() == c.String() {
+			t.Errorf("%s: different seeds made the same map", name)
+		}
+		fresh := a.Clone()
+		fresh.UpdateAll()
+		if !slices.Equal(fresh.cells, a.cells) {
+			t.Errorf("%s: the clearance is out of date", name)
+		}
+	}
+}
+
+func TestGenerateMazeIsConnected(t *testing.T) {
+	for corridor := 1; corridor <= 3; corridor++ {
+		g := New(41, 33)
+		g.GenerateMaze(7, corridor)
+		regions, open := open_regions(g)
+		if regions != 1 {
+			t.Errorf("corridor %d: %d regions\n%s", corridor, regions, g)
+		}
+		if open < len(g.cells)/3 {
+			t.Errorf("corridor %d: only %d open cells", corridor, open)
+		}
+		// corridors are as wide as asked for, so an agent that fits in one gets from any corner of the maze to another.
+		pitch := corridor + 1
+		start := Vec2i{corridor / 2, corridor / 2}
+		goal := start.Add(Vec2i{(42/pitch - 1) * pitch, (34/pitch - 1) * pitch})
+		if _, ok := g.FindPath(PathArgs{Start: start, Goal: goal, MinSpace: (corridor + 1) / 2}); !ok {
+			t.Errorf("corridor %d: no path along the maze\n%s", corridor, g)
+		}
+	}
+}
+
+func TestGenerateRoomsIsConnected(t *testing.T) {
+	for seed := uint64(0); seed < 20; seed++ {
+		g := New(64, 48)
+		g.GenerateRooms(seed, 4)
+		if regions, open := open_regions(g); regions != 1 || open == 0 {
+			t.Fatalf("seed %d: %d regions with %d open cells\n%s", seed, regions, open, g)
+		}
+	}
+}
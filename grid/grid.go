@@ -0,0 +1,177 @@
+// Package grid is a headless occupancy grid with a clearance field and path queries on top of it.
+package grid
+
+import (
+	"image"
+	"slices"
+	"sync"
+)
+
+// TileSize is the width and height of a tile in cells. tiles are the unit of serialization.
+const TileSize = 8
+
+type Cell struct {
+	// closed describes whether this cell is traversable or not. closed means it blocks traversal.
+	closed  bool
+	terrain Terrain
+	// space is the distance to the closest closed cell, where everything outside the grid counts as closed.
+	space int
+	// nearest is the closest closed cell and distance_sq the squared distance to it. they let the clearance field be
+	// updated incrementally.
+	nearest     Vec2i
+	distance_sq int
+	// raise marks the cell as queued for a reset during an incremental update.
+	raise bool
+}
+
+func (c Cell) Closed() bool {
+	return c.closed
+}
+
+func (c Cell) Space() int {
+	return c.space
+}
+
+// Traversable reports whether an agent that needs min_space clearance may stand on this cell. a nil cell is never
+// traversable.
+func (c *Cell) Traversable(min_space int) bool {
+	if c == nil {
+		return false
+	}
+	return !c.closed && c.space >= min_space
+}
+
+type tile struct {
+	cells *[64]Cell
+}
+
+type chunk struct {
+	tiles *[64]tile
+}
+
+type Grid struct {
+	width  int
+	height int
+	cells  []Cell
+	// cache_mu guards jps, which searches on other goroutines fill in.
+	cache_mu sync.Mutex
+	jps      *jps_cache
+}
+
+// New returns an open grid with its clearance field already computed.
+func New(width, height int) *Grid {
+	g := &Grid{
+		width:  width,
+		height: height,
+		cells:  make([]Cell, width*height),
+	}
+	g.UpdateAll()
+	return g
+}
+
+func (g *Grid) Width() int {
+	return g.width
+}
+
+func (g *Grid) Height() int {
+	return g.height
+}
+
+func (g *Grid) InBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && x < g.width && y < g.height
+}
+
+// At returns the cell at x, y or nil when it's out of bounds.
+func (g *Grid) At(x, y int) *Cell {
+	if g.InBounds(x, y) {
+		return &g.cells[x+(y*g.width)]
+	}
+	return nil
+}
+
+func (g *Grid) AtPos(p Vec2i) *Cell {
+	return g.At(p.X, p.Y)
+}
+
+// SetClosed changes the closed state of a cell and updates the clearance of the cells that depend on it. it returns
+// the bounds of every cell whose space changed, which is empty when nothing did.
+func (g *Grid) SetClosed(x, y int, closed bool) image.Rectangle {
+	cell := g.At(x, y)
+	if cell == nil || cell.closed == closed {
+		return image.Rectangle{}
+	}
+	cell.closed = closed
+	return g.update_clearance(Vec2i{x, y})
+}
+
+// CellEdit is the part of a cell's state that can be edited.
+type CellEdit struct {
+	Pos     Vec2i
+	Closed  bool
+	Terrain Terrain
+}
+
+// Edit returns the state of the cell at p, which must be within the grid.
+func (g *Grid) Edit(p Vec2i) CellEdit {
+	cell := g.AtPos(p)
+	return CellEdit{p, cell.closed, cell.terrain}
+}
+
+// SetCells applies edits in order and updates the clearance of the cells that depend on them in a single pass, which
+// is cheaper than calling SetClosed for each. edits outside the grid are ignored. it returns the bounds of every cell
+// whose terrain or space changed.
+func (g *Grid) SetCells(edits []CellEdit) (dirty image.Rectangle) {
+	var changed []Vec2i
+	for _, edit := range edits {
+		cell := g.AtPos(edit.Pos)
+		if cell == nil {
+			continue
+		}
+		if cell.terrain != edit.Terrain {
+			cell.terrain = edit.Terrain
+			dirty = dirty.Union(image.Rect(edit.Pos.X, edit.Pos.Y, edit.Pos.X+1, edit.Pos.Y+1))
+		}
+		if cell.closed != edit.Closed {
+			cell.closed = edit.Closed
+			changed = append(changed, edit.Pos)
+		}
+	}
+	g.clear_caches()
+	if len(changed) > 0 {
+		dirty = dirty.Union(g.update_clearance(changed...))
+	}
+	return dirty
+}
+
+// Clone returns a copy of g, which can be searched from other goroutines while g keeps changing.
+func (g *Grid) Clone() *Grid {
+	return &Grid{
+		width:  g.width,
+		height: g.height,
+		cells:  slices.Clone(g.cells),
+	}
+}
+
+// CopyFrom copies the cells within r from src, which must be the same size as g. it's how a Clone is brought up to date
+// with the cells that changed since, without copying all of them again.
+func (g *Grid) CopyFrom(src *Grid, r image.Rectangle) {
+	g.clear_caches()
+	r = r.Intersect(g.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := r.Min.X + (y * g.width)
+		copy(g.cells[i:i+r.Dx()], src.cells[i:i+r.Dx()])
+	}
+}
+
+// Bounds returns the rectangle covering every cell of the grid.
+func (g *Grid) Bounds() image.Rectangle {
+	return image.Rect(0, 0, g.width, g.height)
+}
+
+// Fill sets every cell to the same closed state.
+func (g *Grid) Fill(closed bool) {
+	for i := range g.cells {
+		g.cells[i].closed = closed
+	}
+	g.UpdateAll()
+}
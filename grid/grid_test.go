@@ -0,0 +1,114 @@
+package grid
+
+import (
+	"strings"
+	"testing"
+)
+
+// parse builds a grid from rows of text where '#' is a closed cell and anything else is open.
+func parse(rows ...string) *Grid {
+	g := New(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				g.At(x, y).closed = true
+			}
+		}
+	}
+	g.UpdateAll()
+	return g
+}
+
+func (g *Grid) String() string {
+	var sb strings.Builder
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			if g.At(x, y).closed {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func TestAtOutOfBounds(t *testing.T) {
+	g := New(4, 3)
+	for _, p := range []Vec2i{{-1, 0}, {0, -1}, {4, 0}, {0, 3}} {
+		if g.AtPos(p) != nil {
+			t.Errorf("expected nil cell at %v", p)
+		}
+	}
+	if g.At(3, 2) == nil {
+		t.Error("expected a cell at 3,2")
+	}
+}
+
+func TestSpaceCountsBorderAsClosed(t *testing.T) {
+	g := New(7, 7)
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 7; x++ {
+			want := min(x+1, y+1, 7-x, 7-y)
+			if got := g.At(x, y).Space(); got != want {
+				t.Errorf("space at %d,%d = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestSetClosedUpdatesSpace(t *testing.T) {
+	g := New(32, 32)
+	g.SetClosed(16, 16, true)
+	if got := g.At(16, 16).Space(); got != 0 {
+		t.Errorf("closed cell space = %d, want 0", got)
+	}
+	if got := g.At(17, 16).Space(); got != 1 {
+		t.Errorf("neighbour space = %d, want 1", got)
+	}
+	if got := g.At(19, 20).Space(); got != 5 {
+		t.Errorf("space at 19,20 = %d, want 5", got)
+	}
+
+	g.SetClosed(16, 16, false)
+	if got := g.At(17, 16).Space(); got != 15 {
+		t.Errorf("space after reopening = %d, want 15", got)
+	}
+}
+
+func TestSpaceIsNotCapped(t *testing.T) {
+	g := New(64, 64)
+	if got := g.At(31, 31).Space(); got != 32 {
+		t.Errorf("space = %d, want 32", got)
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	g := parse(
+		"......",
+		"......",
+		"......",
+	)
+	snapshot := g.Clone()
+	dirty := g.SetClosed(1, 1, true)
+	dirty = dirty.Union(g.SetTerrain(4, 2, TerrainMud))
+	snapshot.CopyFrom(g, dirty)
+	for i := range g.cells {
+		if snapshot.cells[i] != g.cells[i] {
+			t.Fatalf("snapshot:\n%vwant:\n%v", snapshot, g)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	g := New(8, 8)
+	g.Fill(true)
+	if g.At(4, 4).Traversable(0) {
+		t.Error("filled cell is traversable")
+	}
+	g.Fill(false)
+	if !g.At(4, 4).Traversable(4) {
+		t.Error("cleared cell is not traversable")
+	}
+}
@@ -0,0 +1,494 @@
+package grid
+
+import (
+	"container/heap"
+	"image"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Hierarchy answers path queries with hierarchical pathfinding (HPA*). the grid is split into tiles of TileSize cells,
+// and for every clearance class the places where an agent can cross from one tile into the next become the nodes of
+// an abstract graph. a query first searches that small graph and then refines each step of it within a single tile.
+//
+// the abstract graphs are built on first use for each clearance class, or up front by Build. after an edit, pass the
+// rectangle returned by Grid.SetClosed to Invalidate and only the tiles it touches are rebuilt on the next query. a
+// hierarchy is safe for concurrent use, but queries are answered one at a time.
+type Hierarchy struct {
+	// mu guards the abstract graphs, which queries build and rebuild as they go.
+	mu      sync.Mutex
+	g       *Grid
+	tiles_x int
+	tiles_y int
+	classes map[int]*abstract_graph
+}
+
+// abstract_graph is the abstract graph of a single clearance class.
+type abstract_graph struct {
+	min_space int
+	tiles     []abstract_tile
+}
+
+type abstract_tile struct {
+	// dirty means the borders of this tile have to be recomputed.
+	dirty bool
+	// stale means the nodes and edges of this tile have to be recomputed, which happens whenever a border changed.
+	stale bool
+	// east and south hold the crossings into the neighbouring tiles. the west and north crossings are held by the
+	// neighbours.
+	east  []crossing
+	south []crossing
+	nodes []abstract_node
+	// costs holds the cheapest path cost between every pair of nodes without leaving the tile, or +Inf.
+	costs []float64
+}
+
+// crossing is a step from a cell in one tile into an adjacent cell in the neighbouring tile.
+type crossing struct {
+	from Vec2i
+	to   Vec2i
+}
+
+type abstract_node struct {
+	pos Vec2i
+	// links are the cells in neighbouring tiles that can be stepped to from pos.
+	links []Vec2i
+}
+
+// NewHierarchy returns a hierarchy over g. it holds onto g, so the grid must not be resized while it's in use.
+func NewHierarchy(g *Grid) *Hierarchy {
+	return &Hierarchy{
+		g:       g,
+		tiles_x: (g.width + TileSize - 1) / TileSize,
+		tiles_y: (g.height + TileSize - 1) / TileSize,
+		classes: make(map[int]*abstract_graph),
+	}
+}
+
+// Invalidate marks every tile that contains a cell within r for a rebuild.
+func (h *Hierarchy) Invalidate(r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// a cell on the edge of a tile also decides the crossings of the tile next to it.
+	r = r.Inset(-1)
+	for _, graph := range h.classes {
+		for tile_y := max(r.Min.Y/TileSize, 0); tile_y <= min((r.Max.Y-1)/TileSize, h.tiles_y-1); tile_y++ {
+			for tile_x := max(r.Min.X/TileSize, 0); tile_x <= min((r.Max.X-1)/TileSize, h.tiles_x-1); tile_x++ {
+				graph.tiles[tile_x+(tile_y*h.tiles_x)].dirty = true
+			}
+		}
+	}
+}
+
+func (h *Hierarchy) tile_bounds(tile_x, tile_y int) image.Rectangle {
+	return image.Rect(tile_x*TileSize, tile_y*TileSize, (tile_x+1)*TileSize, (tile_y+1)*TileSize).Intersect(h.g.Bounds())
+}
+
+func (h *Hierarchy) tile_of(p Vec2i) (tile_x, tile_y int) {
+	return p.X / TileSize, p.Y / TileSize
+}
+
+func (h *Hierarchy) tile_at(graph *abstract_graph, tile_x, tile_y int) *abstract_tile {
+	if tile_x < 0 || tile_y < 0 || tile_x >= h.tiles_x || tile_y >= h.tiles_y {
+		return nil
+	}
+	return &graph.tiles[tile_x+(tile_y*h.tiles_x)]
+}
+
+// graph returns the abstract graph for min_space with every dirty tile rebuilt. the rebuild counts against l, and it
+// returns nil when l stops it. the tiles it didn't get to are rebuilt by the next call.
+func (h *Hierarchy) graph(min_space int, l *limits) *abstract_graph {
+	graph := h.classes[min_space]
+	if graph == nil {
+		graph = &abstract_graph{
+			min_space: min_space,
+			tiles:     make([]abstract_tile, h.tiles_x*h.tiles_y),
+		}
+		for i := range graph.tiles {
+			graph.tiles[i].dirty = true
+		}
+		h.classes[min_space] = graph
+	}
+	if _, ok := l.check(); !ok {
+		return nil
+	}
+
+	for tile_y := 0; tile_y < h.tiles_y; tile_y++ {
+		for tile_x := 0; tile_x < h.tiles_x; tile_x++ {
+			tile := h.tile_at(graph, tile_x, tile_y)
+			if !tile.dirty {
+				continue
+			}
+			tile.dirty = false
+			h.build_crossings(graph, tile_x, tile_y)
+			// the west and north borders belong to the neighbours, so rebuild them as well.
+			if west := h.tile_at(graph, tile_x-1, tile_y); west != nil {
+				h.build_crossings(graph, tile_x-1, tile_y)
+				west.stale = true
+			}
+			if north := h.tile_at(graph, tile_x, tile_y-1); north != nil {
+				h.build_crossings(graph, tile_x, tile_y-1)
+				north.stale = true
+			}
+			if east := h.tile_at(graph, tile_x+1, tile_y); east != nil {
+				east.stale = true
+			}
+			if south := h.tile_at(graph, tile_x, tile_y+1); south != nil {
+				south.stale = true
+			}
+			tile.stale = true
+		}
+	}
+
+	for tile_y := 0; tile_y < h.tiles_y; tile_y++ {
+		for tile_x := 0; tile_x < h.tiles_x; tile_x++ {
+			if tile := h.tile_at(graph, tile_x, tile_y); tile.stale {
+				if !h.build_nodes(graph, tile_x, tile_y, l) {
+					return nil
+				}
+				tile.stale = false
+			}
+		}
+	}
+	return graph
+}
+
+// build_crossings finds the crossings over the east and south borders of a tile. every run of cells along a border
+// that is open on both sides gets a crossing in its middle, and long runs get one at each end instead.
+func (h *Hierarchy) build_crossings(graph *abstract_graph, tile_x, tile_y int) {
+	const long_run = 6
+
+	tile := h.tile_at(graph, tile_x, tile_y)
+	bounds := h.tile_bounds(tile_x, tile_y)
+
+	scan := func(start, step, across Vec2i, length int) (crossings []crossing) {
+		run := 0
+		flush := func(end Vec2i) {
+			if run == 0 {
+				return
+			}
+			first := end.Add2(-step.X*run, -step.Y*run)
+			last := end.Add2(-step.X, -step.Y)
+			if run < long_run {
+				mid := first.Add2(step.X*(run/2), step.Y*(run/2))
+				crossings = append(crossings, crossing{mid, mid.Add(across)})
+			} else {
+				crossings = append(crossings, crossing{first, first.Add(across)}, crossing{last, last.Add(across)})
+			}
+			run = 0
+		}
+		p := start
+		for i := 0; i < length; i++ {
+			if h.g.AtPos(p).Traversable(graph.min_space) && h.g.AtPos(p.Add(across)).Traversable(graph.min_space) {
+				run++
+			} else {
+				flush(p)
+			}
+			p = p.Add(step)
+		}
+		flush(p)
+		return
+	}
+
+	tile.east = nil
+	if tile_x+1 < h.tiles_x {
+		tile.east = scan(Vec2i{bounds.Max.X - 1, bounds.Min.Y}, Vec2i{0, 1}, Vec2i{1, 0}, bounds.Dy())
+	}
+	tile.south = nil
+	if tile_y+1 < h.tiles_y {
+		tile.south = scan(Vec2i{bounds.Min.X, bounds.Max.Y - 1}, Vec2i{1, 0}, Vec2i{0, 1}, bounds.Dx())
+	}
+}
+
+// build_nodes collects the nodes of a tile from the crossings on all four of its borders and computes the cost between
+// every pair of them. it returns false when l stops it, and the tile has to be built again.
+func (h *Hierarchy) build_nodes(graph *abstract_graph, tile_x, tile_y int, l *limits) bool {
+	tile := h.tile_at(graph, tile_x, tile_y)
+	tile.nodes = tile.nodes[:0]
+
+	add := func(pos, link Vec2i) {
+		for i := range tile.nodes {
+			if tile.nodes[i].pos == pos {
+				tile.nodes[i].links = append(tile.nodes[i].links, link)
+				return
+			}
+		}
+		tile.nodes = append(tile.nodes, abstract_node{pos: pos, links: []Vec2i{link}})
+	}
+
+	for _, c := range tile.east {
+		add(c.from, c.to)
+	}
+	for _, c := range tile.south {
+		add(c.from, c.to)
+	}
+	if west := h.tile_at(graph, tile_x-1, tile_y); west != nil {
+		for _, c := range west.east {
+			add(c.to, c.from)
+		}
+	}
+	if north := h.tile_at(graph, tile_x, tile_y-1); north != nil {
+		for _, c := range north.south {
+			add(c.to, c.from)
+		}
+	}
+
+	bounds := h.tile_bounds(tile_x, tile_y)
+	n := len(tile.nodes)
+	tile.costs = make([]float64, n*n)
+	for i := range tile.nodes {
+		costs := h.g.costs_within(tile.nodes[i].pos, graph.min_space, bounds, l)
+		if costs == nil {
+			return false
+		}
+		for j := range tile.nodes {
+			p := tile.nodes[j].pos
+			tile.costs[i*n+j] = costs[(p.X-bounds.Min.X)+((p.Y-bounds.Min.Y)*bounds.Dx())]
+		}
+	}
+	return true
+}
+
+// costs_within runs dijkstra from start over the cells within bounds and returns the cost to every one of them, indexed
+// relative to bounds. unreachable cells cost +Inf. every cell it settles counts against l, and it returns nil when l
+// stops it.
+func (g *Grid) costs_within(start Vec2i, min_space int, bounds image.Rectangle, l *limits) []float64 {
+	width := bounds.Dx()
+	index := func(p Vec2i) int {
+		return (p.X - bounds.Min.X) + ((p.Y - bounds.Min.Y) * width)
+	}
+
+	cost := make([]float64, width*bounds.Dy())
+	for i := range cost {
+		cost[i] = math.Inf(1)
+	}
+	cost[index(start)] = 0
+
+	var open node_queue
+	heap.Push(&open, node_entry{index(start), 0, 0})
+	for open.Len() > 0 {
+		entry := heap.Pop(&open).(node_entry)
+		if entry.cost != cost[entry.index] {
+			continue
+		}
+		if _, ok := l.expand(); !ok {
+			return nil
+		}
+		cur := Vec2i{bounds.Min.X + entry.index%width, bounds.Min.Y + entry.index/width}
+		for _, dir := range path_directions {
+			next := cur.Add(dir.Vec2i())
+			if !next.in(bounds) || !g.can_step(cur, dir, min_space) {
+				continue
+			}
+			next_cost := entry.cost + g.travel_cost(cur, next)
+			if i := index(next); next_cost < cost[i] {
+				cost[i] = next_cost
+				heap.Push(&open, node_entry{i, next_cost, next_cost})
+			}
+		}
+	}
+	return cost
+}
+
+// Build builds the abstract graph for min_space now, rather than on the first query that needs it.
+func (h *Hierarchy) Build(min_space int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.graph(min_space, nil)
+}
+
+// Entrances returns the cells where agents with min_space clearance cross from one tile into another.
+func (h *Hierarchy) Entrances(min_space int) (entrances []Vec2i) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	graph := h.graph(min_space, nil)
+	for i := range graph.tiles {
+		for _, node := range graph.tiles[i].nodes {
+			entrances = append(entrances, node.pos)
+		}
+	}
+	return
+}
+
+// FindPath searches for a path from arg.Start to arg.Goal through the abstract graph. the paths are close to but not
+// always as cheap as the ones from Grid.FindPath. queries with arg.MaxDistance, and queries that can't reach the goal
+// but have arg.MaxReach set, are answered by Grid.FindPath. arg.ClearanceWeight only shapes the path within each tile,
+// since the abstract graph is shared by every query.
+func (h *Hierarchy) FindPath(arg PathArgs) ([]Vec2i, bool) {
+	result := h.Search(arg)
+	return result.Path, result.Status == PathFound
+}
+
+// Search is FindPath, but it also says why the search ended and how much work it took. once the start and goal tiles
+// differ, the nodes of the abstract graph count as expanded, along with the cells it takes to rebuild the graph after
+// an edit and to join the start and goal to it. a search that runs out of budget or time while it walks the graph
+// refines the way to the most promising node.
+func (h *Hierarchy) Search(arg PathArgs) PathResult {
+	g := h.g
+	if arg.MaxDistance > 0 {
+		return g.Search(arg)
+	}
+	h.mu.Lock()
+	result := h.find_path(arg)
+	h.mu.Unlock()
+	if result.Status == PathNotFound && arg.MaxReach > 0 {
+		// the fallback gets what's left of the budget.
+		if arg.MaxExpanded > 0 {
+			if arg.MaxExpanded -= result.Expanded; arg.MaxExpanded <= 0 {
+				return PathResult{nil, PathBudgetExhausted, result.Expanded}
+			}
+		}
+		fallback := g.Search(arg)
+		fallback.Expanded += result.Expanded
+		return fallback
+	}
+	return result
+}
+
+func (h *Hierarchy) find_path(arg PathArgs) PathResult {
+	g := h.g
+	if !g.InBounds(arg.Start.X, arg.Start.Y) || !g.AtPos(arg.Goal).Traversable(arg.MinSpace) {
+		return PathResult{Status: PathNotFound}
+	}
+
+	start_x, start_y := h.tile_of(arg.Start)
+	goal_x, goal_y := h.tile_of(arg.Goal)
+	start_bounds := h.tile_bounds(start_x, start_y)
+	goal_bounds := h.tile_bounds(goal_x, goal_y)
+
+	l := limits{arg: &arg}
+	if start_bounds == goal_bounds {
+		local := g.find_path(arg, start_bounds)
+		if local.Status == PathFound || local.Status.stopped() {
+			return local
+		}
+		l.expanded = local.Expanded
+	}
+
+	// rebuilding the graph after an edit and joining the start and goal to it count against the limits as well.
+	graph := h.graph(arg.MinSpace, &l)
+	if graph == nil {
+		return PathResult{nil, l.stop, l.expanded}
+	}
+
+	// the start and goal join the abstract graph through the nodes of their own tiles.
+	start_costs := g.costs_within(arg.Start, arg.MinSpace, start_bounds, &l)
+	if start_costs == nil {
+		return PathResult{nil, l.stop, l.expanded}
+	}
+	goal_costs := g.costs_within(arg.Goal, arg.MinSpace, goal_bounds, &l)
+	if goal_costs == nil {
+		return PathResult{nil, l.stop, l.expanded}
+	}
+	local_cost := func(costs []float64, bounds image.Rectangle, p Vec2i) float64 {
+		return costs[(p.X-bounds.Min.X)+((p.Y-bounds.Min.Y)*bounds.Dx())]
+	}
+
+	// the abstract search is keyed by cell index, but only touches the few cells that are nodes.
+	index := func(p Vec2i) int {
+		return p.X + (p.Y * g.width)
+	}
+	pos := func(i int) Vec2i {
+		return Vec2i{i % g.width, i / g.width}
+	}
+	cost := map[int]float64{index(arg.Start): 0}
+	prev := map[int]int{}
+	closed := map[int]bool{}
+	var open node_queue
+	push := func(from, to Vec2i, to_cost float64) {
+		i := index(to)
+		if old, ok := cost[i]; ok && old <= to_cost {
+			return
+		}
+		cost[i] = to_cost
+		prev[i] = index(from)
+		heap.Push(&open, node_entry{i, to_cost + octile(to, arg.Goal), to_cost})
+	}
+
+	heap.Push(&open, node_entry{index(arg.Start), octile(arg.Start, arg.Goal), 0})
+	status := PathNotFound
+	end := -1
+	best_estimate := math.Inf(1)
+	for open.Len() > 0 {
+		entry := heap.Pop(&open).(node_entry)
+		if closed[entry.index] || entry.cost != cost[entry.index] {
+			continue
+		}
+		if stop, ok := l.expand(); !ok {
+			status = stop
+			break
+		}
+		closed[entry.index] = true
+		cur := pos(entry.index)
+		if cur == arg.Goal {
+			status = PathFound
+			end = entry.index
+			break
+		}
+		if estimate := octile(cur, arg.Goal); estimate < best_estimate {
+			end = entry.index
+			best_estimate = estimate
+		}
+
+		tile_x, tile_y := h.tile_of(cur)
+		tile := h.tile_at(graph, tile_x, tile_y)
+		if cur == arg.Start {
+			for _, node := range tile.nodes {
+				if c := local_cost(start_costs, start_bounds, node.pos); !math.IsInf(c, 1) {
+					push(cur, node.pos, c)
+				}
+			}
+		}
+		if tile_x == goal_x && tile_y == goal_y {
+			if c := local_cost(goal_costs, goal_bounds, cur); !math.IsInf(c, 1) {
+				push(cur, arg.Goal, entry.cost+c)
+			}
+		}
+
+		i := slices.IndexFunc(tile.nodes, func(n abstract_node) bool { return n.pos == cur })
+		if i == -1 {
+			continue
+		}
+		n := len(tile.nodes)
+		for j, other := range tile.nodes {
+			if c := tile.costs[i*n+j]; j != i && !math.IsInf(c, 1) {
+				push(cur, other.pos, entry.cost+c)
+			}
+		}
+		for _, link := range tile.nodes[i].links {
+			push(cur, link, entry.cost+g.travel_cost(cur, link))
+		}
+	}
+	if status == PathNotFound || status == PathCancelled || end == -1 {
+		return PathResult{nil, status, l.expanded}
+	}
+
+	var waypoints []Vec2i
+	for i := end; i != index(arg.Start); i = prev[i] {
+		waypoints = append(waypoints, pos(i))
+	}
+	waypoints = append(waypoints, arg.Start)
+	slices.Reverse(waypoints)
+
+	// every pair of waypoints is either a single step over a border or two cells within the same tile.
+	path := []Vec2i{arg.Start}
+	for i := 1; i < len(waypoints); i++ {
+		from, to := waypoints[i-1], waypoints[i]
+		from_x, from_y := h.tile_of(from)
+		to_x, to_y := h.tile_of(to)
+		if from_x != to_x || from_y != to_y {
+			path = append(path, to)
+			continue
+		}
+		local := g.find_path(PathArgs{Start: from, Goal: to, MinSpace: arg.MinSpace, Context: arg.Context, ClearanceWeight: arg.ClearanceWeight}, h.tile_bounds(from_x, from_y))
+		if local.Status != PathFound {
+			return PathResult{nil, local.Status, l.expanded}
+		}
+		path = append(path, local.Path[1:]...)
+	}
+	return PathResult{path, status, l.expanded}
+}
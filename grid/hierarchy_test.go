@@ -0,0 +1,144 @@
+package grid
+
+import (
+	"context"
+	"image"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestHierarchyFindPath(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	worst := 1.0
+	for i := 0; i < 100; i++ {
+		width, height := 8+rng.Intn(72), 8+rng.Intn(72)
+		g := random_grid(rng, width, height, rng.Float64()*0.35)
+		h := NewHierarchy(g)
+		for j := 0; j < 10; j++ {
+			args := PathArgs{
+				Start:    Vec2i{rng.Intn(width), rng.Intn(height)},
+				Goal:     Vec2i{rng.Intn(width), rng.Intn(height)},
+				MinSpace: 1 + rng.Intn(3),
+			}
+			want, want_ok := g.FindPath(args)
+			got, got_ok := h.FindPath(args)
+			if got_ok != want_ok {
+				t.Fatalf("map %d query %d: %+v found = %v, want %v\n%s", i, j, args, got_ok, want_ok, g)
+			}
+			if !got_ok {
+				continue
+			}
+			check_path(t, g, got, args.MinSpace)
+			if got[0] != args.Start || got[len(got)-1] != args.Goal {
+				t.Fatalf("map %d query %d: path goes from %v to %v", i, j, got[0], got[len(got)-1])
+			}
+			if c := PathLength(want); c > 0 {
+				worst = max(worst, PathLength(got)/c)
+			}
+		}
+	}
+	// hierarchical paths stick to the crossings, which costs a little on noisy maps but never this much.
+	if worst > 2 {
+		t.Errorf("worst path is %.2f times the optimal cost", worst)
+	}
+}
+
+func TestHierarchyInvalidate(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	g := random_grid(rng, 64, 48, 0.2)
+	h := NewHierarchy(g)
+	for min_space := 1; min_space <= 2; min_space++ {
+		h.graph(min_space, nil)
+	}
+
+	for i := 0; i < 100; i++ {
+		x, y := rng.Intn(64), rng.Intn(48)
+		h.Invalidate(g.SetClosed(x, y, !g.At(x, y).Closed()))
+
+		fresh := NewHierarchy(g)
+		for min_space := 1; min_space <= 2; min_space++ {
+			got, want := h.graph(min_space, nil), fresh.graph(min_space, nil)
+			for k := range want.tiles {
+				if !reflect.DeepEqual(got.tiles[k].nodes, want.tiles[k].nodes) && !(len(got.tiles[k].nodes) == 0 && len(want.tiles[k].nodes) == 0) {
+					t.Fatalf("edit %d class %d: tile %d nodes = %v, want %v", i, min_space, k, got.tiles[k].nodes, want.tiles[k].nodes)
+				}
+				if !reflect.DeepEqual(got.tiles[k].costs, want.tiles[k].costs) {
+					t.Fatalf("edit %d class %d: tile %d costs differ", i, min_space, k)
+				}
+			}
+		}
+	}
+}
+
+func TestHierarchyInvalidateIsLocal(t *testing.T) {
+	g := New(128, 128)
+	h := NewHierarchy(g)
+	graph := h.graph(1, nil)
+
+	h.Invalidate(image.Rect(20, 20, 21, 21))
+	dirty := 0
+	for i := range graph.tiles {
+		if graph.tiles[i].dirty {
+			dirty++
+		}
+	}
+	if dirty != 1 {
+		t.Errorf("%d tiles are dirty, want 1", dirty)
+	}
+
+	// cells on the edge of a tile also touch the neighbour.
+	h.Invalidate(image.Rect(32, 42, 33, 43))
+	dirty = 0
+	for i := range graph.tiles {
+		if graph.tiles[i].dirty {
+			dirty++
+		}
+	}
+	if dirty != 3 {
+		t.Errorf("%d tiles are dirty, want 3", dirty)
+	}
+}
+
+func TestHierarchyCancelledRebuild(t *testing.T) {
+	g := New(128, 128)
+	h := NewHierarchy(g)
+	graph := h.graph(1, nil)
+	h.Invalidate(image.Rect(20, 20, 21, 21))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := h.Search(PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{127, 127}, MinSpace: 1, Context: ctx})
+	if result.Status != PathCancelled {
+		t.Errorf("status = %v, want %v", result.Status, PathCancelled)
+	}
+	for i := range graph.tiles {
+		if graph.tiles[i].stale {
+			t.Errorf("tile %d was rebuilt", i)
+		}
+	}
+	if tile_x, tile_y := h.tile_of(Vec2i{20, 20}); !h.tile_at(graph, tile_x, tile_y).dirty {
+		t.Error("the edited tile was rebuilt")
+	}
+}
+
+func BenchmarkHierarchyFindPath(b *testing.B) {
+	g := random_grid(rand.New(rand.NewSource(12)), 256, 256, 0.1)
+	args := PathArgs{Start: Vec2i{3, 3}, Goal: Vec2i{250, 240}, MinSpace: 1}
+	g.SetClosed(args.Start.X, args.Start.Y, false)
+	g.SetClosed(args.Goal.X, args.Goal.Y, false)
+	h := NewHierarchy(g)
+	if _, ok := h.FindPath(args); !ok {
+		b.Fatal("no path")
+	}
+	b.Run("astar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			g.FindPath(args)
+		}
+	})
+	b.Run("hierarchy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			h.FindPath(args)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package grid
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	_ "image/png"
+	"io"
+)
+
+// ImportImage reads a PNG or PGM image into a new grid of the given size, where dark pixels become closed cells. a
+// size <= 0 takes the size of the image instead.
+func ImportImage(r io.Reader, width, height int) (*Grid, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return FromImage(img, width, height)
+}
+
+// FromImage resamples img to a grid of the given size by averaging the pixels under every cell, and closes the cells
+// that come out darker than mid grey. transparent pixels count as white. a size <= 0 takes the size of the image.
+func FromImage(img image.Image, width, height int) (*Grid, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("grid: image is empty")
+	}
+	if width <= 0 || height <= 0 {
+		width, height = bounds.Dx(), bounds.Dy()
+	}
+
+	g := &Grid{
+		width:  width,
+		height: height,
+		cells:  make([]Cell, width*height),
+	}
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var sum, n uint64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					sum += uint64(luminance(img.At(px, py)))
+					n++
+				}
+			}
+			g.cells[x+(y*width)].closed = sum/n < 0x8000
+		}
+	}
+	g.UpdateAll()
+	return g, nil
+}
+
+// luminance is how bright c is over a white background, from 0 to 0xffff.
+func luminance(c color.Color) uint32 {
+	r, g, b, a := c.RGBA()
+	// the same weights as color.GrayModel. the colour is premultiplied, so the background shows through by 1-a.
+	y := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	return y + (0xffff - a)
+}
+
+// OccupancyImage draws g at a pixel per cell, black where it's closed and white where it's open. it reads back into
+// the same grid with FromImage.
+func (g *Grid) OccupancyImage() *image.Gray {
+	img := image.NewGray(g.Bounds())
+	for i := range g.cells {
+		if !g.cells[i].closed {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+// SpaceImage draws the space of every cell at a pixel per cell, from black where it's closed to white where it's at
+// least max_space.
+func (g *Grid) SpaceImage(max_space int) *image.Gray {
+	max_space = max(max_space, 1)
+	img := image.NewGray(g.Bounds())
+	for i := range g.cells {
+		img.Pix[i] = uint8(min(g.cells[i].space, max_space) * 0xff / max_space)
+	}
+	return img
+}
+
+// PathImage draws path over the OccupancyImage of g. the path is green, from its blue start to its red end.
+func (g *Grid) PathImage(path []Vec2i) *image.RGBA {
+	img := image.NewRGBA(g.Bounds())
+	occupancy := g.OccupancyImage()
+	for i, y := range occupancy.Pix {
+		img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3] = y, y, y, 0xff
+	}
+	for i, p := range path {
+		clr := color.RGBA{64, 200, 96, 0xff}
+		if i == 0 {
+			clr = color.RGBA{32, 96, 196, 0xff}
+		} else if i == len(path)-1 {
+			clr = color.RGBA{220, 48, 96, 0xff}
+		}
+		img.SetRGBA(p.X, p.Y, clr)
+	}
+	return img
+}
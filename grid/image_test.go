@@ -0,0 +1,89 @@
+package grid
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestImageRoundTrip(t *testing.T) {
+	g := random_grid(rand.New(rand.NewSource(21)), 23, 17, 0.4)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, g.OccupancyImage()); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ImportImage(&buf, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.String(), g.String(); got != want {
+		t.Errorf("imported grid differs:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := loaded.At(5, 5).Space(), g.At(5, 5).Space(); got != want {
+		t.Errorf("space = %d, want %d", got, want)
+	}
+}
+
+func TestFromImageResamples(t *testing.T) {
+	// every cell covers a 3x3 block of pixels, and the top left block is mostly dark.
+	img := image.NewNRGBA(image.Rect(0, 0, 6, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	for _, p := range []image.Point{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}} {
+		img.Set(p.X, p.Y, color.Black)
+	}
+	// transparent pixels count as white, whatever their colour.
+	img.Set(3, 3, color.NRGBA{0, 0, 0, 0})
+	g, err := FromImage(img, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.String(), "#.\n..\n"; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestDecodePGM(t *testing.T) {
+	plain := "P2\n# a comment\n3 2\n4\n0 4 3\n4 0 4\n"
+	binary := "P5 3 2 255\n\x00\xff\x80\xff\x00\xff"
+	for name, data := range map[string]string{"plain": plain, "binary": binary} {
+		g, err := ImportImage(strings.NewReader(data), 0, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := g.String(), "#..\n.#.\n"; got != want {
+			t.Errorf("%s: got\n%swant\n%s", name, got, want)
+		}
+	}
+
+	for _, bad := range []string{"P5 3 2 255\n\x00", "P2 3 2 4\n0 5 0 0 0 0", "P2 0 2 4\n", "P7 1 1 1\n\x00"} {
+		if _, err := ImportImage(strings.NewReader(bad), 0, 0); err == nil {
+			t.Errorf("%q decoded without an error", bad)
+		}
+	}
+}
+
+func TestDecodePGMHugeHeader(t *testing.T) {
+	for _, bad := range []string{"P5 999999999 999999999 255\n", "P5 30000 30000 255\n\x00\x00", "P2 99999999999999999999 1 1\n"} {
+		if _, err := DecodePGM(strings.NewReader(bad)); !errors.Is(err, ErrPGM) {
+			t.Errorf("%q: err = %v, want ErrPGM", bad, err)
+		}
+	}
+}
+
+func TestSpaceImage(t *testing.T) {
+	g := New(7, 7)
+	g.SetClosed(6, 6, true)
+	img := g.SpaceImage(2)
+	if img.GrayAt(6, 6).Y != 0 || img.GrayAt(0, 0).Y != 0x7f || img.GrayAt(3, 3).Y != 0xff {
+		t.Errorf("pixels = %v", img.Pix)
+	}
+}
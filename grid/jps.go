@@ -0,0 +1,291 @@
+package grid
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+)
+
+// jps_cache holds what SearchJPS needs to know about the cells, which takes a pass over all of them to work out. it's
+// dropped whenever a cell changes.
+type jps_cache struct {
+	uniform bool
+	// passable holds for every clearance class whether each cell is traversable.
+	passable map[int][]bool
+}
+
+// clear_caches drops everything the grid worked out from its cells, and is called whenever they change.
+func (g *Grid) clear_caches() {
+	g.cache_mu.Lock()
+	g.jps = nil
+	g.cache_mu.Unlock()
+}
+
+// jps_passable returns whether every cell is traversable with min_space clearance, and false when the terrain isn't
+// uniform. the table must not be modified.
+func (g *Grid) jps_passable(min_space int) ([]bool, bool) {
+	g.cache_mu.Lock()
+	defer g.cache_mu.Unlock()
+	if g.jps == nil {
+		g.jps = &jps_cache{uniform: g.uniform_terrain(), passable: make(map[int][]bool)}
+	}
+	if !g.jps.uniform {
+		return nil, false
+	}
+	passable := g.jps.passable[min_space]
+	if passable == nil {
+		passable = make([]bool, len(g.cells))
+		for i := range g.cells {
+			passable[i] = g.cells[i].Traversable(min_space)
+		}
+		g.jps.passable[min_space] = passable
+	}
+	return passable, true
+}
+
+// FindPathJPS searches for the cheapest path from arg.Start to arg.Goal with jump point search. it finds paths of the
+// same cost as FindPath but only expands the cells where the shape of the surrounding walls forces a turn, which is far
+// fewer on open maps. the corner rule is the same as FindPath: a diagonal step needs both cells beside it to be
+// traversable. when the goal can't be reached and arg.MaxReach is set, it falls back to FindPath for the partial path.
+// jumps assume every step costs the same, so grids with terrain other than roads, and queries with
+// arg.ClearanceWeight, are answered by FindPath as well.
+func (g *Grid) FindPathJPS(arg PathArgs) ([]Vec2i, bool) {
+	result := g.SearchJPS(arg)
+	return result.Path, result.Status == PathFound
+}
+
+// SearchJPS is FindPathJPS, but it also says why the search ended and how much work it took. only jump points count as
+// expanded nodes.
+func (g *Grid) SearchJPS(arg PathArgs) PathResult {
+	if !g.InBounds(arg.Start.X, arg.Start.Y) {
+		return PathResult{Status: PathNotFound}
+	}
+	if arg.ClearanceWeight > 0 {
+		return g.Search(arg)
+	}
+	// the jumps test the same cells over and over, so answer them from a flat table that's kept until the grid changes.
+	passable, uniform := g.jps_passable(arg.MinSpace)
+	if !uniform {
+		return g.Search(arg)
+	}
+
+	max_distance := arg.MaxDistance * arg.MaxDistance
+	walkable := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= g.width || y >= g.height || !passable[x+(y*g.width)] {
+			return false
+		}
+		return max_distance == 0 || arg.Start.DistanceSq(Vec2i{x, y}) <= max_distance
+	}
+
+	// jump moves from x, y in the direction of dx, dy until it finds a cell that must be expanded. that's the goal, a
+	// cell with a forced neighbour, or for diagonals a cell from which a straight jump finds one.
+	var jump func(x, y, dx, dy int) (Vec2i, bool)
+	jump = func(x, y, dx, dy int) (Vec2i, bool) {
+		for {
+			if !walkable(x, y) {
+				return Vec2i{}, false
+			}
+			if x == arg.Goal.X && y == arg.Goal.Y {
+				return Vec2i{x, y}, true
+			}
+			if dx != 0 && dy != 0 {
+				if _, ok := jump(x+dx, y, dx, 0); ok {
+					return Vec2i{x, y}, true
+				}
+				if _, ok := jump(x, y+dy, 0, dy); ok {
+					return Vec2i{x, y}, true
+				}
+			} else if dx != 0 {
+				if (walkable(x, y-1) && !walkable(x-dx, y-1)) || (walkable(x, y+1) && !walkable(x-dx, y+1)) {
+					return Vec2i{x, y}, true
+				}
+			} else if dy != 0 {
+				if (walkable(x-1, y) && !walkable(x-1, y-dy)) || (walkable(x+1, y) && !walkable(x+1, y-dy)) {
+					return Vec2i{x, y}, true
+				}
+			}
+			if !walkable(x+dx, y) || !walkable(x, y+dy) {
+				return Vec2i{}, false
+			}
+			x += dx
+			y += dy
+		}
+	}
+
+	// neighbours returns the directions worth jumping in from p, given the direction it was reached from.
+	neighbours := func(p Vec2i, dx, dy int) (dirs []Vec2i) {
+		x, y := p.X, p.Y
+		if dx == 0 && dy == 0 {
+			for _, dir := range path_directions {
+				if g.can_step(p, dir, arg.MinSpace) && walkable(x+dir.Vec2i().X, y+dir.Vec2i().Y) {
+					dirs = append(dirs, dir.Vec2i())
+				}
+			}
+		} else if dx != 0 && dy != 0 {
+			vertical := walkable(x, y+dy)
+			horizontal := walkable(x+dx, y)
+			if vertical {
+				dirs = append(dirs, Vec2i{0, dy})
+			}
+			if horizontal {
+				dirs = append(dirs, Vec2i{dx, 0})
+			}
+			if vertical && horizontal && walkable(x+dx, y+dy) {
+				dirs = append(dirs, Vec2i{dx, dy})
+			}
+		} else if dx != 0 {
+			next := walkable(x+dx, y)
+			below := walkable(x, y+1)
+			above := walkable(x, y-1)
+			if next {
+				dirs = append(dirs, Vec2i{dx, 0})
+				if below && walkable(x+dx, y+1) {
+					dirs = append(dirs, Vec2i{dx, 1})
+				}
+				if above && walkable(x+dx, y-1) {
+					dirs = append(dirs, Vec2i{dx, -1})
+				}
+			}
+			if below {
+				dirs = append(dirs, Vec2i{0, 1})
+			}
+			if above {
+				dirs = append(dirs, Vec2i{0, -1})
+			}
+		} else {
+			next := walkable(x, y+dy)
+			right := walkable(x+1, y)
+			left := walkable(x-1, y)
+			if next {
+				dirs = append(dirs, Vec2i{0, dy})
+				if right && walkable(x+1, y+dy) {
+					dirs = append(dirs, Vec2i{1, dy})
+				}
+				if left && walkable(x-1, y+dy) {
+					dirs = append(dirs, Vec2i{-1, dy})
+				}
+			}
+			if right {
+				dirs = append(dirs, Vec2i{1, 0})
+			}
+			if left {
+				dirs = append(dirs, Vec2i{-1, 0})
+			}
+		}
+		return
+	}
+
+	index := func(p Vec2i) int {
+		return p.X + (p.Y * g.width)
+	}
+	pos := func(i int) Vec2i {
+		return Vec2i{i % g.width, i / g.width}
+	}
+
+	cost := make([]float64, len(g.cells))
+	prev := make([]int32, len(g.cells))
+	state := make([]uint8, len(g.cells))
+
+	start := index(arg.Start)
+	state[start] = node_open
+	prev[start] = int32(start)
+
+	var open node_queue
+	heap.Push(&open, node_entry{start, octile(arg.Start, arg.Goal), 0})
+
+	construct_path := func(end int) []Vec2i {
+		return expand_jump_points(construct_jump_points(prev, start, end, pos))
+	}
+	best := -1
+	best_estimate := math.Inf(1)
+
+	l := limits{arg: &arg}
+	for open.Len() > 0 {
+		entry := heap.Pop(&open).(node_entry)
+		if state[entry.index] == node_closed || entry.cost != cost[entry.index] {
+			continue
+		}
+		if status, ok := l.expand(); !ok {
+			return l.stopped(status, best, construct_path)
+		}
+		state[entry.index] = node_closed
+		cur := pos(entry.index)
+
+		if cur == arg.Goal {
+			return PathResult{construct_path(entry.index), PathFound, l.expanded}
+		}
+		if estimate := octile(cur, arg.Goal); estimate < best_estimate {
+			best = entry.index
+			best_estimate = estimate
+		}
+
+		parent := pos(int(prev[entry.index]))
+		dx, dy := sign(cur.X-parent.X), sign(cur.Y-parent.Y)
+
+		for _, dir := range neighbours(cur, dx, dy) {
+			jump_point, ok := jump(cur.X+dir.X, cur.Y+dir.Y, dir.X, dir.Y)
+			if !ok {
+				continue
+			}
+			i := index(jump_point)
+			if state[i] == node_closed {
+				continue
+			}
+			next_cost := entry.cost + octile(cur, jump_point)
+			if state[i] == node_open && next_cost >= cost[i] {
+				continue
+			}
+			state[i] = node_open
+			cost[i] = next_cost
+			prev[i] = int32(entry.index)
+			heap.Push(&open, node_entry{i, next_cost + octile(jump_point, arg.Goal), next_cost})
+		}
+	}
+
+	if arg.MaxReach > 0 {
+		// the fallback gets what's left of the budget.
+		if arg.MaxExpanded > 0 {
+			if arg.MaxExpanded -= l.expanded; arg.MaxExpanded == 0 {
+				return l.stopped(PathBudgetExhausted, best, construct_path)
+			}
+		}
+		result := g.Search(arg)
+		result.Expanded += l.expanded
+		return result
+	}
+	return PathResult{nil, PathNotFound, l.expanded}
+}
+
+func construct_jump_points(prev []int32, start, end int, pos func(int) Vec2i) (points []Vec2i) {
+	for end != start {
+		points = append(points, pos(end))
+		end = int(prev[end])
+	}
+	points = append(points, pos(start))
+	slices.Reverse(points)
+	return
+}
+
+// expand_jump_points fills in the cells between consecutive jump points, which are always on a straight or diagonal
+// line.
+func expand_jump_points(points []Vec2i) []Vec2i {
+	path := []Vec2i{points[0]}
+	for i := 1; i < len(points); i++ {
+		cur, end := points[i-1], points[i]
+		dx, dy := sign(end.X-cur.X), sign(end.Y-cur.Y)
+		for cur != end {
+			cur = cur.Add2(dx, dy)
+			path = append(path, cur)
+		}
+	}
+	return path
+}
+
+func sign(i int) int {
+	if i < 0 {
+		return -1
+	} else if i > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package grid
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestFindPathJPSMatchesFindPath(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	for i := 0; i < 500; i++ {
+		width, height := 8+rng.Intn(56), 8+rng.Intn(56)
+		g := random_grid(rng, width, height, rng.Float64()*0.4)
+		for j := 0; j < 10; j++ {
+			args := PathArgs{
+				Start:    Vec2i{rng.Intn(width), rng.Intn(height)},
+				Goal:     Vec2i{rng.Intn(width), rng.Intn(height)},
+				MinSpace: 1 + rng.Intn(3),
+			}
+			want, want_ok := g.FindPath(args)
+			got, got_ok := g.FindPathJPS(args)
+			if got_ok != want_ok {
+				t.Fatalf("map %d query %d: %+v found = %v, want %v\n%s", i, j, args, got_ok, want_ok, g)
+			}
+			if !got_ok {
+				continue
+			}
+			check_path(t, g, got, args.MinSpace)
+			if got[0] != args.Start || got[len(got)-1] != args.Goal {
+				t.Fatalf("map %d query %d: path goes from %v to %v", i, j, got[0], got[len(got)-1])
+			}
+			if math.Abs(PathLength(got)-PathLength(want)) > 1e-9 {
+				t.Fatalf("map %d query %d: %+v cost = %f, want %f\n%s", i, j, args, PathLength(got), PathLength(want), g)
+			}
+		}
+	}
+}
+
+func TestFindPathJPSPartial(t *testing.T) {
+	g := parse(
+		"........",
+		"........",
+		"#######.",
+		"........",
+		"......#.",
+		"......##",
+		"......#.",
+	)
+	args := PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{7, 6}, MinSpace: 1}
+	if path, ok := g.FindPathJPS(args); ok || path != nil {
+		t.Fatalf("path = %v, %v, want nothing", path, ok)
+	}
+	args.MaxReach = 3
+	if path, ok := g.FindPathJPS(args); ok || len(path) == 0 {
+		t.Fatalf("path = %v, %v, want a partial path", path, ok)
+	}
+}
+
+func TestFindPathJPSAfterEdits(t *testing.T) {
+	g := parse(
+		"........",
+		"........",
+		"........",
+	)
+	args := PathArgs{Start: Vec2i{0, 1}, Goal: Vec2i{7, 1}, MinSpace: 1}
+	if _, ok := g.FindPathJPS(args); !ok {
+		t.Fatal("no path on an open grid")
+	}
+	// every edit has to reach the cached tables.
+	for y := 0; y < 3; y++ {
+		g.SetClosed(4, y, true)
+	}
+	if path, ok := g.FindPathJPS(args); ok {
+		t.Fatalf("path = %v through a wall", path)
+	}
+	g.SetCells([]CellEdit{{Pos: Vec2i{4, 2}, Terrain: TerrainMud}})
+	if path, ok := g.FindPathJPS(args); !ok || !slices.Contains(path, Vec2i{4, 2}) {
+		t.Fatalf("path = %v, %v, want one through the door", path, ok)
+	}
+}
+
+func BenchmarkFindPath(b *testing.B) {
+	// open rooms separated by long walls with a single door each, which make A* flood most of every room.
+	g := New(256, 256)
+	for x := 32; x < 256; x += 32 {
+		for y := 0; y < 256; y++ {
+			if y != (x*7)%256 {
+				g.At(x, y).closed = true
+			}
+		}
+	}
+	g.UpdateAll()
+	args := PathArgs{Start: Vec2i{3, 3}, Goal: Vec2i{250, 240}, MinSpace: 1}
+	b.Run("astar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			g.FindPath(args)
+		}
+	})
+	b.Run("jps", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			g.FindPathJPS(args)
+		}
+	})
+}
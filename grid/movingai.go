@@ -0,0 +1,135 @@
+package grid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// the MovingAI grid benchmarks (https://movingai.com/benchmarks/formats.html) are a map file and a scenario file of
+// queries on it with the length of their optimal paths.
+
+var ErrMovingAI = errors.New("grid: invalid movingai file")
+
+// movingai_max_size is the widest and tallest map that's decoded. the rows are read before the grid is made, so a
+// header can't make it allocate more than the input holds either.
+const movingai_max_size = 1 << 15
+
+// DecodeMovingAI reads a MovingAI .map file. '.', 'G' and 'S' are open and everything else, out of bounds, trees and
+// water, is closed. the benchmarks count every one of those open cells the same and don't let diagonals cut corners,
+// like FindPath, so their optimal lengths apply to the paths found on the grid.
+func DecodeMovingAI(r io.Reader) (*Grid, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	width, height := -1, -1
+	for {
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("%w: no map section", ErrMovingAI)
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 1 && fields[0] == "map" {
+			break
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: header line %q", ErrMovingAI, scanner.Text())
+		}
+		switch fields[0] {
+		case "type":
+			if fields[1] != "octile" {
+				return nil, fmt.Errorf("%w: map type %q", ErrMovingAI, fields[1])
+			}
+		case "width", "height":
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n <= 0 || n > movingai_max_size {
+				return nil, fmt.Errorf("%w: %s %q", ErrMovingAI, fields[0], fields[1])
+			}
+			if fields[0] == "width" {
+				width = n
+			} else {
+				height = n
+			}
+		}
+	}
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("%w: missing width or height", ErrMovingAI)
+	}
+
+	var closed []bool
+	for y := 0; y < height; y++ {
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("%w: %d of %d rows", ErrMovingAI, y, height)
+		}
+		row := strings.TrimRight(scanner.Text(), "\r")
+		if len(row) != width {
+			return nil, fmt.Errorf("%w: row %d is %d cells wide, want %d", ErrMovingAI, y, len(row), width)
+		}
+		for x := 0; x < width; x++ {
+			switch row[x] {
+			case '.', 'G', 'S':
+				closed = append(closed, false)
+			default:
+				closed = append(closed, true)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	g := New(width, height)
+	for i := range g.cells {
+		g.cells[i].closed = closed[i]
+	}
+	g.UpdateAll()
+	return g, nil
+}
+
+// Scenario is a query from a MovingAI .scen file.
+type Scenario struct {
+	Bucket int
+	// Map is the name of the map file, usually relative to the scenario file.
+	Map string
+	// Width and Height are the size of the map.
+	Width, Height int
+	Start, Goal   Vec2i
+	// Optimal is the length of the shortest path, where cardinal steps are 1 and diagonal steps √2.
+	Optimal float64
+}
+
+// DecodeScenarios reads a MovingAI .scen file.
+func DecodeScenarios(r io.Reader) ([]Scenario, error) {
+	var scenarios []Scenario
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || (line == 1 && strings.HasPrefix(text, "version")) {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 9 {
+			return nil, fmt.Errorf("%w: line %d has %d fields, want 9", ErrMovingAI, line, len(fields))
+		}
+		s := Scenario{Map: fields[1]}
+		ints := []*int{&s.Bucket, nil, &s.Width, &s.Height, &s.Start.X, &s.Start.Y, &s.Goal.X, &s.Goal.Y}
+		for i, field := range ints {
+			if field == nil {
+				continue
+			}
+			n, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrMovingAI, line, err)
+			}
+			*field = n
+		}
+		optimal, err := strconv.ParseFloat(fields[8], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMovingAI, line, err)
+		}
+		s.Optimal = optimal
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, scanner.Err()
+}
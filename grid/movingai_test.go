@@ -0,0 +1,75 @@
+package grid
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+const movingai_map = `type octile
+height 4
+width 6
+map
+..@...
+.T.GS.
+..W...
+@.....
+`
+
+func TestDecodeMovingAI(t *testing.T) {
+	g, err := DecodeMovingAI(strings.NewReader(movingai_map))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "..#...\n.#....\n..#...\n#.....\n"
+	if got := g.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+
+	for _, bad := range []string{
+		"type octile\nheight 2\nwidth 2\nmap\n..\n",
+		"type octile\nheight 1\nwidth 2\nmap\n...\n",
+		"type hex\nheight 1\nwidth 1\nmap\n.\n",
+		"height 1\nwidth 1\n",
+		"type octile\nheight 999999999\nwidth 999999999\nmap\n",
+		"type octile\nheight 30000\nwidth 30000\nmap\n..\n",
+	} {
+		if _, err := DecodeMovingAI(strings.NewReader(bad)); !errors.Is(err, ErrMovingAI) {
+			t.Errorf("%q: err = %v, want %v", bad, err, ErrMovingAI)
+		}
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	g, err := DecodeMovingAI(strings.NewReader(movingai_map))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scen := "version 1\n" +
+		"0\ttest.map\t6\t4\t0\t0\t5\t0\t9.82842712\n" +
+		"0\ttest.map\t6\t4\t1\t3\t5\t3\t4.00000000\n"
+	scenarios, err := DecodeScenarios(strings.NewReader(scen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) != 2 {
+		t.Fatalf("%d scenarios, want 2", len(scenarios))
+	}
+	if s := scenarios[0]; s.Map != "test.map" || s.Width != 6 || s.Height != 4 || s.Goal != (Vec2i{5, 0}) {
+		t.Errorf("scenario = %+v", s)
+	}
+	for _, s := range scenarios {
+		path, ok := g.FindPath(PathArgs{Start: s.Start, Goal: s.Goal, MinSpace: 1})
+		if !ok {
+			t.Fatalf("%+v: no path", s)
+		}
+		if length := PathLength(path); math.Abs(length-s.Optimal) > 1e-6 {
+			t.Errorf("%+v: length = %f", s, length)
+		}
+	}
+
+	if _, err := DecodeScenarios(strings.NewReader("0\ttest.map\t6\t4\n")); !errors.Is(err, ErrMovingAI) {
+		t.Errorf("err = %v, want %v", err, ErrMovingAI)
+	}
+}
@@ -0,0 +1,390 @@
+package grid
+
+import (
+	"container/heap"
+	"context"
+	"image"
+	"math"
+	"slices"
+	"time"
+)
+
+type PathArgs struct {
+	Start Vec2i
+	Goal  Vec2i
+	// MinSpace is the minimum required space for any given cell to allow traversal.
+	MinSpace int
+	// MaxDistance determines the farthest from the start position we should be allowed to search. no limit <= 0
+	MaxDistance int
+	// MaxReach determines the farthest distance from the goal we're allowed to form a path to.
+	MaxReach int
+	// MaxExpanded is how many nodes the search may expand before it gives up with the best partial path so far. no
+	// limit <= 0
+	MaxExpanded int
+	// Deadline is when the search gives up with the best partial path so far. no limit when zero.
+	Deadline time.Time
+	// Context stops the search early once it's done, in which case no path is returned. nil never stops.
+	Context context.Context
+	// ClearanceWeight makes cells with little more than MinSpace clearance more expensive to step onto, so paths take
+	// the middle of a corridor when there's room to. a step onto a cell with exactly MinSpace costs 1+ClearanceWeight
+	// times as much, and the extra shrinks with every cell of space beyond that. no penalty <= 0
+	ClearanceWeight float64
+}
+
+// PathStatus says how a path query ended.
+type PathStatus int
+
+const (
+	// PathFound means the path reaches the goal.
+	PathFound PathStatus = iota
+	// PathPartial means the goal can't be reached, and the path ends at the closest cell within MaxReach of it.
+	PathPartial
+	// PathNotFound means the goal can't be reached and there's no partial path either.
+	PathNotFound
+	// PathBudgetExhausted means MaxExpanded nodes were expanded without reaching the goal.
+	PathBudgetExhausted
+	// PathDeadlineExceeded means the Deadline passed before the goal was reached.
+	PathDeadlineExceeded
+	// PathCancelled means the Context was done before the goal was reached.
+	PathCancelled
+)
+
+func (s PathStatus) String() string {
+	switch s {
+	case PathFound:
+		return "found"
+	case PathPartial:
+		return "partial"
+	case PathNotFound:
+		return "not found"
+	case PathBudgetExhausted:
+		return "budget exhausted"
+	case PathDeadlineExceeded:
+		return "deadline exceeded"
+	case PathCancelled:
+		return "cancelled"
+	default:
+		return "?"
+	}
+}
+
+// stopped reports whether the search was stopped by one of the limits in PathArgs before it could finish.
+func (s PathStatus) stopped() bool {
+	return s == PathBudgetExhausted || s == PathDeadlineExceeded || s == PathCancelled
+}
+
+// PathResult is the answer to a path query. when the search ran out of budget or time, Path leads to the expanded
+// node closest to the goal, which is the most promising one. a cancelled search has no path.
+type PathResult struct {
+	Path   []Vec2i
+	Status PathStatus
+	// Expanded is how many nodes the search expanded.
+	Expanded int
+}
+
+// check_interval is how many nodes a search expands between checks of the clock and PathArgs.Context.
+const check_interval = 256
+
+// limits counts the nodes a search expands and checks them against the limits in its PathArgs. a nil *limits has none.
+type limits struct {
+	arg      *PathArgs
+	expanded int
+	// stop is why the search has to stop, once expand or check has returned false.
+	stop PathStatus
+}
+
+// expand counts one more expanded node. it returns false along with the reason when the search has to stop instead.
+func (l *limits) expand() (PathStatus, bool) {
+	if l == nil {
+		return PathFound, true
+	}
+	if l.arg.MaxExpanded > 0 && l.expanded >= l.arg.MaxExpanded {
+		l.stop = PathBudgetExhausted
+		return l.stop, false
+	}
+	if l.expanded%check_interval == 0 {
+		if status, ok := l.check(); !ok {
+			return status, false
+		}
+	}
+	l.expanded++
+	return PathFound, true
+}
+
+// check is expand without counting a node, for work that is about to start and might not expand any.
+func (l *limits) check() (PathStatus, bool) {
+	if l == nil {
+		return PathFound, true
+	}
+	if l.arg.Context != nil && l.arg.Context.Err() != nil {
+		l.stop = PathCancelled
+		return l.stop, false
+	}
+	if !l.arg.Deadline.IsZero() && time.Now().After(l.arg.Deadline) {
+		l.stop = PathDeadlineExceeded
+		return l.stop, false
+	}
+	return PathFound, true
+}
+
+const (
+	cardinal_cost = 1.0
+	diagonal_cost = math.Sqrt2
+)
+
+// octile is the cost of the cheapest path from a to b on an empty grid, where cardinal steps cost 1 and diagonal
+// steps cost √2.
+func octile(a, b Vec2i) float64 {
+	dx := abs(b.X - a.X)
+	dy := abs(b.Y - a.Y)
+	return cardinal_cost*float64(max(dx, dy)) + (diagonal_cost-cardinal_cost)*float64(min(dx, dy))
+}
+
+// PathLength is the length of path, where cardinal steps are 1 and diagonal steps √2, whatever the terrain.
+func PathLength(path []Vec2i) float64 {
+	var length float64
+	for i := 1; i < len(path); i++ {
+		length += octile(path[i-1], path[i])
+	}
+	return length
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// step_cost is the cost of a step in dir from one cell to the next, terrain and clearance penalty included.
+func (arg *PathArgs) step_cost(dir Direction, from, to Cell) float64 {
+	cost := cardinal_cost
+	if dir.Diagonal() {
+		cost = diagonal_cost
+	}
+	cost *= (from.terrain.Cost() + to.terrain.Cost()) / 2
+	if arg.ClearanceWeight > 0 {
+		cost *= 1 + arg.ClearanceWeight/float64(1+max(to.space-arg.MinSpace, 0))
+	}
+	return cost
+}
+
+// can_step reports whether an agent with min_space clearance may move from p in dir. diagonal steps may not cut the
+// corner of a blocked cell.
+func (g *Grid) can_step(p Vec2i, dir Direction, min_space int) bool {
+	if dir.Diagonal() {
+		if !g.AtPos(p.Add(dir.RotateCW().Vec2i())).Traversable(min_space) {
+			return false
+		} else if !g.AtPos(p.Add(dir.RotateCCW().Vec2i())).Traversable(min_space) {
+			return false
+		}
+	}
+	return g.AtPos(p.Add(dir.Vec2i())).Traversable(min_space)
+}
+
+const (
+	node_unvisited uint8 = iota
+	node_open
+	node_closed
+)
+
+// FindPath searches for the cheapest path from arg.Start to arg.Goal with A*, where steps cost more through rougher
+// terrain. when the goal can't be reached but arg.MaxReach is set, the path to the closest cell within reach of the
+// goal is returned along with false. so is the best partial path when the search runs out of budget or time.
+func (g *Grid) FindPath(arg PathArgs) ([]Vec2i, bool) {
+	result := g.Search(arg)
+	return result.Path, result.Status == PathFound
+}
+
+// Search is FindPath, but it also says why the search ended and how much work it took.
+func (g *Grid) Search(arg PathArgs) PathResult {
+	return g.find_path(arg, g.Bounds())
+}
+
+// find_path is Search restricted to the cells within bounds. its state is sized to bounds, so searching a small area
+// of a large grid is cheap.
+func (g *Grid) find_path(arg PathArgs, bounds image.Rectangle) PathResult {
+	bounds = bounds.Intersect(g.Bounds())
+	if !arg.Start.in(bounds) {
+		return PathResult{Status: PathNotFound}
+	}
+	return astar(arg, grid_nodes{g, bounds})
+}
+
+// search_nodes is the space an A* search runs in. the cells it may step onto are numbered, and the search keeps its
+// state for each in slices indexed by those numbers.
+type search_nodes interface {
+	// size is how many cells are numbered up front. numbers past it are handed out as cells are discovered.
+	size() int
+	// id returns the number of p, which is within the space.
+	id(p Vec2i) int
+	pos(id int) Vec2i
+	// step returns the number of the cell reached by stepping from p in dir and what the step costs, or false when the
+	// step leaves the space or an agent with arg.MinSpace clearance can't take it.
+	step(arg *PathArgs, p Vec2i, dir Direction) (id int, cost float64, ok bool)
+}
+
+// grid_nodes numbers the cells within bounds row by row.
+type grid_nodes struct {
+	g      *Grid
+	bounds image.Rectangle
+}
+
+func (n grid_nodes) size() int {
+	return n.bounds.Dx() * n.bounds.Dy()
+}
+
+func (n grid_nodes) id(p Vec2i) int {
+	return (p.X - n.bounds.Min.X) + ((p.Y - n.bounds.Min.Y) * n.bounds.Dx())
+}
+
+func (n grid_nodes) pos(id int) Vec2i {
+	return Vec2i{n.bounds.Min.X + id%n.bounds.Dx(), n.bounds.Min.Y + id/n.bounds.Dx()}
+}
+
+func (n grid_nodes) step(arg *PathArgs, p Vec2i, dir Direction) (int, float64, bool) {
+	next := p.Add(dir.Vec2i())
+	if !next.in(n.bounds) || !n.g.can_step(p, dir, arg.MinSpace) {
+		return 0, 0, false
+	}
+	return n.id(next), arg.step_cost(dir, *n.g.AtPos(p), *n.g.AtPos(next)), true
+}
+
+// astar searches for the cheapest path from arg.Start, which must be within nodes, to arg.Goal. it's the search behind
+// both Grid.Search and World.Search.
+func astar[N search_nodes](arg PathArgs, nodes N) PathResult {
+	size := nodes.size()
+	cost := make([]float64, size)
+	prev := make([]int32, size)
+	state := make([]uint8, size)
+	// grow makes room for the state of cells numbered as they're discovered.
+	grow := func(i int) {
+		for len(state) <= i {
+			cost = append(cost, 0)
+			prev = append(prev, 0)
+			state = append(state, node_unvisited)
+		}
+	}
+
+	start := nodes.id(arg.Start)
+	grow(start)
+	construct_path := func(end int) (path []Vec2i) {
+		for end != start {
+			path = append(path, nodes.pos(end))
+			end = int(prev[end])
+		}
+		path = append(path, arg.Start)
+		slices.Reverse(path)
+		return
+	}
+
+	var open node_queue
+	state[start] = node_open
+	heap.Push(&open, node_entry{start, octile(arg.Start, arg.Goal), 0})
+
+	max_reach := arg.MaxReach * arg.MaxReach
+	max_distance := arg.MaxDistance * arg.MaxDistance
+
+	closest := -1
+	closest_distance := math.MaxInt
+	best := -1
+	best_estimate := math.Inf(1)
+
+	l := limits{arg: &arg}
+	for open.Len() > 0 {
+		entry := heap.Pop(&open).(node_entry)
+		if state[entry.index] == node_closed || entry.cost != cost[entry.index] {
+			continue
+		}
+		if status, ok := l.expand(); !ok {
+			return l.stopped(status, best, construct_path)
+		}
+		state[entry.index] = node_closed
+		cur := nodes.pos(entry.index)
+
+		if cur == arg.Goal {
+			return PathResult{construct_path(entry.index), PathFound, l.expanded}
+		}
+
+		if estimate := octile(cur, arg.Goal); estimate < best_estimate {
+			best = entry.index
+			best_estimate = estimate
+		}
+
+		if distance := cur.DistanceSq(arg.Goal); max_reach > 0 && distance < closest_distance && distance <= max_reach {
+			closest = entry.index
+			closest_distance = distance
+		}
+
+		for _, dir := range path_directions {
+			next := cur.Add(dir.Vec2i())
+			if max_distance > 0 && next.DistanceSq(arg.Start) > max_distance {
+				continue
+			}
+			i, step_cost, ok := nodes.step(&arg, cur, dir)
+			if !ok {
+				continue
+			}
+			grow(i)
+			if state[i] == node_closed {
+				continue
+			}
+
+			next_cost := entry.cost + step_cost
+			if state[i] == node_open && next_cost >= cost[i] {
+				continue
+			}
+
+			state[i] = node_open
+			cost[i] = next_cost
+			prev[i] = int32(entry.index)
+			heap.Push(&open, node_entry{i, next_cost + octile(next, arg.Goal), next_cost})
+		}
+	}
+
+	// we didn't reach our goal, but we can still return a sub-optimal.
+	if closest != -1 {
+		return PathResult{construct_path(closest), PathPartial, l.expanded}
+	}
+
+	return PathResult{nil, PathNotFound, l.expanded}
+}
+
+// stopped is the result of a search that had to stop for status. best is the node closest to the goal so far, or -1,
+// and construct_path leads to it.
+func (l *limits) stopped(status PathStatus, best int, construct_path func(int) []Vec2i) PathResult {
+	result := PathResult{Status: status, Expanded: l.expanded}
+	if status != PathCancelled && best != -1 {
+		result.Path = construct_path(best)
+	}
+	return result
+}
+
+type node_entry struct {
+	index    int
+	estimate float64
+	cost     float64
+}
+
+// node_queue is a min-heap of search nodes ordered by their estimated total cost. ties prefer the node that is further
+// along, which is the one closer to the goal.
+type node_queue []node_entry
+
+func (q node_queue) Len() int { return len(q) }
+
+func (q node_queue) Less(i, j int) bool {
+	if q[i].estimate != q[j].estimate {
+		return q[i].estimate < q[j].estimate
+	}
+	return q[i].cost > q[j].cost
+}
+
+func (q node_queue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *node_queue) Push(x any)   { *q = append(*q, x.(node_entry)) }
+
+func (q *node_queue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
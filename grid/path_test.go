@@ -0,0 +1,354 @@
+package grid
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// check_path verifies that path is a valid walk through g for the given clearance.
+func check_path(t *testing.T, g *Grid, path []Vec2i, min_space int) {
+	t.Helper()
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		if max(abs(dx), abs(dy)) != 1 {
+			t.Fatalf("step %d from %v to %v is not adjacent", i, a, b)
+		}
+		if !g.AtPos(b).Traversable(min_space) {
+			t.Fatalf("step %d enters blocked cell %v", i, b)
+		}
+		if dx != 0 && dy != 0 {
+			if !g.At(a.X+dx, a.Y).Traversable(min_space) || !g.At(a.X, a.Y+dy).Traversable(min_space) {
+				t.Fatalf("step %d from %v to %v cuts a corner", i, a, b)
+			}
+		}
+	}
+}
+
+func TestFindPathStraight(t *testing.T) {
+	g := New(16, 16)
+	path, ok := g.FindPath(PathArgs{Start: Vec2i{1, 1}, Goal: Vec2i{10, 1}, MinSpace: 1})
+	if !ok {
+		t.Fatal("no path")
+	}
+	if len(path) != 10 {
+		t.Errorf("path length = %d, want 10", len(path))
+	}
+	if path[0] != (Vec2i{1, 1}) || path[len(path)-1] != (Vec2i{10, 1}) {
+		t.Errorf("path endpoints = %v, %v", path[0], path[len(path)-1])
+	}
+	check_path(t, g, path, 1)
+}
+
+func TestFindPathAroundWall(t *testing.T) {
+	g := parse(
+		"........",
+		"...#....",
+		"...#....",
+		"...#....",
+		"........",
+	)
+	path, ok := g.FindPath(PathArgs{Start: Vec2i{1, 2}, Goal: Vec2i{6, 2}, MinSpace: 1})
+	if !ok {
+		t.Fatal("no path")
+	}
+	check_path(t, g, path, 1)
+}
+
+func TestFindPathNoCornerCutting(t *testing.T) {
+	g := parse(
+		"..#",
+		"#..",
+		"...",
+	)
+	path, ok := g.FindPath(PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{1, 1}, MinSpace: 1})
+	if !ok {
+		t.Fatal("no path")
+	}
+	check_path(t, g, path, 1)
+	if len(path) != 3 {
+		t.Errorf("path = %v, want a detour through 1,0", path)
+	}
+
+	g = parse(
+		".#",
+		"#.",
+	)
+	if _, ok := g.FindPath(PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{1, 1}, MinSpace: 1}); ok {
+		t.Error("found a path through a diagonal gap")
+	}
+}
+
+func TestFindPathMinSpace(t *testing.T) {
+	g := parse(
+		"..........",
+		"..........",
+		"..........",
+		"#####.####",
+		"..........",
+		"..........",
+		"..........",
+	)
+	args := PathArgs{Start: Vec2i{5, 1}, Goal: Vec2i{5, 5}, MinSpace: 1}
+	if path, ok := g.FindPath(args); !ok {
+		t.Error("size 1 can't pass through the gap")
+	} else {
+		check_path(t, g, path, 1)
+	}
+	args.MinSpace = 2
+	if _, ok := g.FindPath(args); ok {
+		t.Error("size 2 passed through a gap of width 1")
+	}
+}
+
+func TestFindPathMaxReach(t *testing.T) {
+	g := parse(
+		"........",
+		"........",
+		"#######.",
+		"........",
+		"......#.",
+		"......##",
+		"......#.",
+	)
+	args := PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{7, 6}, MinSpace: 1}
+	if _, ok := g.FindPath(args); ok {
+		t.Fatal("reached an enclosed goal")
+	}
+	if path, _ := g.FindPath(args); path != nil {
+		t.Fatal("got a partial path without max reach")
+	}
+
+	args.MaxReach = 3
+	path, ok := g.FindPath(args)
+	if ok {
+		t.Fatal("reached an enclosed goal")
+	}
+	if len(path) == 0 {
+		t.Fatal("no partial path")
+	}
+	check_path(t, g, path, 1)
+	if end := path[len(path)-1]; end.DistanceSq(args.Goal) > 9 {
+		t.Errorf("partial path ends at %v, outside of reach", end)
+	}
+}
+
+func TestFindPathDiagonalCost(t *testing.T) {
+	g := New(32, 32)
+	args := PathArgs{Start: Vec2i{2, 3}, Goal: Vec2i{20, 9}, MinSpace: 1}
+	path, ok := g.FindPath(args)
+	if !ok {
+		t.Fatal("no path")
+	}
+	check_path(t, g, path, 1)
+	if got, want := PathLength(path), octile(args.Start, args.Goal); math.Abs(got-want) > 1e-9 {
+		t.Errorf("path cost = %f, want %f", got, want)
+	}
+	// 6 diagonal and 12 cardinal steps.
+	if len(path) != 19 {
+		t.Errorf("path length = %d, want 19", len(path))
+	}
+}
+
+func TestFindPathMaxDistance(t *testing.T) {
+	g := New(32, 32)
+	args := PathArgs{Start: Vec2i{2, 2}, Goal: Vec2i{20, 2}, MinSpace: 1, MaxDistance: 10}
+	if _, ok := g.FindPath(args); ok {
+		t.Error("reached a goal outside of max distance")
+	}
+	args.MaxReach = 10
+	path, ok := g.FindPath(args)
+	if ok || len(path) == 0 {
+		t.Fatalf("path = %v, %v, want a partial path", path, ok)
+	}
+	if end := path[len(path)-1]; end != (Vec2i{12, 2}) {
+		t.Errorf("partial path ends at %v, want 12,2", end)
+	}
+}
+
+// MaxDistance is measured from the start, so a detour that stays close to the goal but strays too far from the start
+// is ruled out.
+func TestFindPathMaxDistanceFromStart(t *testing.T) {
+	g := parse(
+		"...........",
+		"##########.",
+		"...........",
+	)
+	args := PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{9, 2}, MinSpace: 1, MaxDistance: 10}
+	for name, find := range map[string]func(PathArgs) ([]Vec2i, bool){"astar": g.FindPath, "jps": g.FindPathJPS} {
+		if path, ok := find(args); ok {
+			t.Errorf("%s: path = %v through the gap more than 10 cells from the start", name, path)
+		}
+	}
+	args.MaxDistance = 11
+	for name, find := range map[string]func(PathArgs) ([]Vec2i, bool){"astar": g.FindPath, "jps": g.FindPathJPS} {
+		if _, ok := find(args); !ok {
+			t.Errorf("%s: no path with the gap within reach", name)
+		}
+	}
+}
+
+func TestFindPathClearanceWeight(t *testing.T) {
+	g := New(24, 9)
+	args := PathArgs{Start: Vec2i{1, 1}, Goal: Vec2i{22, 1}, MinSpace: 1}
+	hugging, _ := g.FindPath(args)
+
+	args.ClearanceWeight = 4
+	path, ok := g.FindPath(args)
+	if !ok {
+		t.Fatal("no path")
+	}
+	check_path(t, g, path, 1)
+	weighted_cost := func(path []Vec2i) (cost float64) {
+		for i := 1; i < len(path); i++ {
+			dir := North
+			if path[i].X != path[i-1].X && path[i].Y != path[i-1].Y {
+				dir = Northeast
+			}
+			cost += args.step_cost(dir, *g.AtPos(path[i-1]), *g.AtPos(path[i]))
+		}
+		return
+	}
+	if got, wall := weighted_cost(path), weighted_cost(hugging); got >= wall {
+		t.Errorf("weighted path costs %f, the one along the wall %f", got, wall)
+	}
+	if deepest := slices.MaxFunc(path, func(a, b Vec2i) int { return a.Y - b.Y }); deepest.Y < 3 {
+		t.Errorf("path stays along the wall: %v", path)
+	}
+	if jps, _ := g.FindPathJPS(args); !slices.Equal(jps, path) {
+		t.Errorf("jump point search ignored the clearance weight: %v", jps)
+	}
+}
+
+// dijkstra_cost is a reference search that finds the cost of the cheapest path from start to goal, or -1.
+func dijkstra_cost(g *Grid, start, goal Vec2i, min_space int) float64 {
+	cost := map[Vec2i]float64{start: 0}
+	done := map[Vec2i]bool{}
+	for {
+		cur, best := Vec2i{}, math.Inf(1)
+		for p, c := range cost {
+			if !done[p] && c < best {
+				cur, best = p, c
+			}
+		}
+		if math.IsInf(best, 1) {
+			return -1
+		}
+		if cur == goal {
+			return best
+		}
+		done[cur] = true
+		for _, dir := range path_directions {
+			if !g.can_step(cur, dir, min_space) {
+				continue
+			}
+			next := cur.Add(dir.Vec2i())
+			c := best + octile(cur, next)
+			if old, ok := cost[next]; !ok || c < old {
+				cost[next] = c
+			}
+		}
+	}
+}
+
+func TestFindPathIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 100; i++ {
+		g := random_grid(rng, 24, 24, 0.3)
+		start := Vec2i{rng.Intn(24), rng.Intn(24)}
+		goal := Vec2i{rng.Intn(24), rng.Intn(24)}
+		min_space := 1 + rng.Intn(2)
+		want := dijkstra_cost(g, start, goal, min_space)
+		path, ok := g.FindPath(PathArgs{Start: start, Goal: goal, MinSpace: min_space})
+		if ok != (want >= 0) {
+			t.Fatalf("map %d: found = %v, want %v\n%s", i, ok, want >= 0, g)
+		}
+		if !ok {
+			continue
+		}
+		check_path(t, g, path, min_space)
+		if got := PathLength(path); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("map %d: path cost = %f, want %f", i, got, want)
+		}
+	}
+}
+
+func TestSearchStatus(t *testing.T) {
+	g := parse(
+		"....#...",
+		"....#...",
+		"....#...",
+	)
+	tests := []struct {
+		args PathArgs
+		want PathStatus
+	}{
+		{PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{3, 2}, MinSpace: 1}, PathFound},
+		{PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{7, 2}, MinSpace: 1}, PathNotFound},
+		{PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{7, 2}, MinSpace: 1, MaxReach: 4}, PathPartial},
+	}
+	for _, test := range tests {
+		if got := g.Search(test.args); got.Status != test.want {
+			t.Errorf("%+v: status = %v, want %v", test.args, got.Status, test.want)
+		}
+	}
+}
+
+func TestSearchBudget(t *testing.T) {
+	// jump point search crosses open maps in a couple of jumps, so give it something to turn around.
+	g := random_grid(rand.New(rand.NewSource(17)), 64, 64, 0.2)
+	start, goal := Vec2i{0, 0}, Vec2i{63, 63}
+	g.SetClosed(start.X, start.Y, false)
+	g.SetClosed(goal.X, goal.Y, false)
+	// building the abstract graph counts against the budget too, so build it first to only count the search itself.
+	h := NewHierarchy(g)
+	h.Build(1)
+	searches := map[string]func(PathArgs) PathResult{
+		"A*":           g.Search,
+		"jps":          g.SearchJPS,
+		"hierarchical": h.Search,
+	}
+	for name, search := range searches {
+		unlimited := search(PathArgs{Start: start, Goal: goal, MinSpace: 1})
+		if unlimited.Status != PathFound {
+			t.Fatalf("%s: status = %v without a budget", name, unlimited.Status)
+		}
+		if enough := search(PathArgs{Start: start, Goal: goal, MinSpace: 1, MaxExpanded: unlimited.Expanded}); enough.Status != PathFound {
+			t.Errorf("%s: status = %v with a budget of %d", name, enough.Status, unlimited.Expanded)
+		}
+
+		budget := max(unlimited.Expanded/2, 1)
+		got := search(PathArgs{Start: start, Goal: goal, MinSpace: 1, MaxExpanded: budget})
+		if got.Status != PathBudgetExhausted {
+			t.Fatalf("%s: status = %v, want %v", name, got.Status, PathBudgetExhausted)
+		}
+		if got.Expanded != budget {
+			t.Errorf("%s: expanded %d nodes with a budget of %d", name, got.Expanded, budget)
+		}
+		if len(got.Path) == 0 || got.Path[0] != start {
+			t.Fatalf("%s: partial path %v doesn't start at %v", name, got.Path, start)
+		}
+		check_path(t, g, got.Path, 1)
+		if end := got.Path[len(got.Path)-1]; octile(end, goal) >= octile(start, goal) {
+			t.Errorf("%s: partial path ends at %v, which is no closer to the goal", name, end)
+		}
+	}
+}
+
+func TestSearchDeadline(t *testing.T) {
+	g := New(64, 64)
+	args := PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{63, 63}, MinSpace: 1, Deadline: time.Now().Add(-time.Second)}
+	got := g.Search(args)
+	if got.Status != PathDeadlineExceeded {
+		t.Fatalf("status = %v, want %v", got.Status, PathDeadlineExceeded)
+	}
+	if got.Expanded != 0 || got.Path != nil {
+		t.Errorf("expanded %d nodes into %v after the deadline", got.Expanded, got.Path)
+	}
+	if path, ok := g.FindPath(args); ok || path != nil {
+		t.Errorf("FindPath = %v, %v after the deadline", path, ok)
+	}
+}
@@ -0,0 +1,135 @@
+package grid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// PGM images are decoded by image.Decode once this package is imported, both the binary ("P5") and the plain ("P2")
+// variants.
+func init() {
+	image.RegisterFormat("pgm", "P5", DecodePGM, decode_pgm_config)
+	image.RegisterFormat("pgm", "P2", DecodePGM, decode_pgm_config)
+}
+
+var ErrPGM = errors.New("grid: invalid pgm image")
+
+// pgm_max_size is the widest and tallest image that's decoded. the samples are read before the image is made, so a
+// header can't make it allocate more than the input holds either.
+const pgm_max_size = 1 << 15
+
+type pgm_header struct {
+	plain         bool
+	width, height int
+	max_value     int
+}
+
+// read_pgm_header reads up to and including the single whitespace that separates the header from the samples.
+func read_pgm_header(r *bufio.Reader) (header pgm_header, err error) {
+	magic := make([]byte, 2)
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return header, err
+	}
+	switch string(magic) {
+	case "P5":
+	case "P2":
+		header.plain = true
+	default:
+		return header, fmt.Errorf("%w: magic %q", ErrPGM, magic)
+	}
+	for _, field := range []*int{&header.width, &header.height, &header.max_value} {
+		if *field, err = read_pgm_int(r); err != nil {
+			return header, err
+		}
+	}
+	if header.width <= 0 || header.height <= 0 || header.width > pgm_max_size || header.height > pgm_max_size ||
+		header.max_value <= 0 || header.max_value > 0xffff {
+		return header, fmt.Errorf("%w: %dx%d with a maximum of %d", ErrPGM, header.width, header.height, header.max_value)
+	}
+	return header, nil
+}
+
+// read_pgm_int skips whitespace and comments, and reads a decimal number along with the whitespace that ends it.
+func read_pgm_int(r *bufio.Reader) (int, error) {
+	var digits []byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && len(digits) > 0 {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrPGM, err)
+		}
+		switch {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c)
+			continue
+		case c == '#' && len(digits) == 0:
+			if _, err := r.ReadBytes('\n'); err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrPGM, err)
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			if len(digits) == 0 {
+				continue
+			}
+		default:
+			return 0, fmt.Errorf("%w: unexpected %q", ErrPGM, c)
+		}
+		break
+	}
+	n, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrPGM, err)
+	}
+	return n, nil
+}
+
+// DecodePGM reads a binary or plain PGM image. samples are scaled from the image's maximum value to 8 bits.
+func DecodePGM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	header, err := read_pgm_header(br)
+	if err != nil {
+		return nil, err
+	}
+	sample_size := 1
+	if header.max_value > 0xff {
+		sample_size = 2
+	}
+	sample := make([]byte, sample_size)
+	// pix grows as samples arrive, rather than being sized by the header up front.
+	count := header.width * header.height
+	var pix []uint8
+	for range count {
+		var value int
+		if header.plain {
+			if value, err = read_pgm_int(br); err != nil {
+				return nil, err
+			}
+		} else {
+			if _, err := io.ReadFull(br, sample); err != nil {
+				return nil, fmt.Errorf("%w: %d of %d samples: %v", ErrPGM, len(pix), count, err)
+			}
+			for _, b := range sample {
+				value = value<<8 | int(b)
+			}
+		}
+		if value > header.max_value {
+			return nil, fmt.Errorf("%w: sample %d is above the maximum of %d", ErrPGM, value, header.max_value)
+		}
+		pix = append(pix, uint8(value*0xff/header.max_value))
+	}
+	return &image.Gray{Pix: pix, Stride: header.width, Rect: image.Rect(0, 0, header.width, header.height)}, nil
+}
+
+func decode_pgm_config(r io.Reader) (image.Config, error) {
+	header, err := read_pgm_header(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.GrayModel, Width: header.width, Height: header.height}, nil
+}
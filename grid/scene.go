@@ -0,0 +1,92 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Scene is everything besides the walls that's needed to reproduce a path query. it's saved alongside the grid so a
+// single map file can replay a query exactly.
+type Scene struct {
+	Player      Vec2i
+	Goal        Vec2i
+	PlayerSize  int
+	MaxReach    int
+	MaxDistance int
+	// Search is the id of the search the query was made with, like SearchAStar. maps saved before the ids may name it
+	// however the application labelled it.
+	Search          string
+	ClearanceWeight float64
+	MaxExpanded     int
+}
+
+// the ids of the searches a Scene can be made with. they're stable, unlike whatever the application calls them.
+const (
+	SearchAStar     = "astar"
+	SearchJPS       = "jps"
+	SearchHierarchy = "hierarchy"
+)
+
+// PathArgs returns the path query the scene describes.
+func (s *Scene) PathArgs() PathArgs {
+	return PathArgs{
+		Start:           s.Player,
+		Goal:            s.Goal,
+		MinSpace:        s.PlayerSize,
+		MaxDistance:     s.MaxDistance,
+		MaxReach:        s.MaxReach,
+		MaxExpanded:     s.MaxExpanded,
+		ClearanceWeight: s.ClearanceWeight,
+	}
+}
+
+var section_scene = [4]byte{'S', 'C', 'N', 'E'}
+
+// scene_fields are stored in the "SCNE" section as int32s in this order, followed by Search as a uint16 length and its
+// bytes, and then the fields that were appended since: ClearanceWeight as a float64 and MaxExpanded as an int32.
+// readers ignore anything after the fields they know, and zero the ones a file is too short for, so more can be
+// appended.
+func (s *Scene) fields() []*int {
+	return []*int{&s.Player.X, &s.Player.Y, &s.Goal.X, &s.Goal.Y, &s.PlayerSize, &s.MaxReach, &s.MaxDistance}
+}
+
+func (s *Scene) marshal() []byte {
+	var buf bytes.Buffer
+	for _, field := range s.fields() {
+		binary.Write(&buf, binary.LittleEndian, int32(*field))
+	}
+	binary.Write(&buf, binary.LittleEndian, uint16(len(s.Search)))
+	buf.WriteString(s.Search)
+	binary.Write(&buf, binary.LittleEndian, s.ClearanceWeight)
+	binary.Write(&buf, binary.LittleEndian, int32(s.MaxExpanded))
+	return buf.Bytes()
+}
+
+func (s *Scene) unmarshal(payload []byte) error {
+	fields := s.fields()
+	if len(payload) < len(fields)*4+2 {
+		return fmt.Errorf("%w: scene is too short", ErrCorrupt)
+	}
+	for _, field := range fields {
+		*field = int(int32(binary.LittleEndian.Uint32(payload)))
+		payload = payload[4:]
+	}
+	n := int(binary.LittleEndian.Uint16(payload))
+	payload = payload[2:]
+	if len(payload) < n {
+		return fmt.Errorf("%w: scene is too short", ErrCorrupt)
+	}
+	s.Search = string(payload[:n])
+	payload = payload[n:]
+	s.ClearanceWeight, s.MaxExpanded = 0, 0
+	if len(payload) >= 8 {
+		s.ClearanceWeight = math.Float64frombits(binary.LittleEndian.Uint64(payload))
+		payload = payload[8:]
+	}
+	if len(payload) >= 4 {
+		s.MaxExpanded = int(int32(binary.LittleEndian.Uint32(payload)))
+	}
+	return nil
+}
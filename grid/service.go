@@ -0,0 +1,165 @@
+package grid
+
+import (
+	"context"
+	"sync"
+)
+
+// PathRequest is a path query for a PathService.
+type PathRequest struct {
+	// ID says who the path is for. a newer request with the same ID cancels the older one.
+	ID   int
+	Args PathArgs
+	// Search answers the query. it runs on another goroutine, so it should search a grid that isn't being changed, like
+	// one from Grid.Clone. it's stopped through Args.Context.
+	Search func(PathArgs) PathResult
+}
+
+// PathResponse is the answer to a PathRequest.
+type PathResponse struct {
+	ID   int
+	Args PathArgs
+	PathResult
+}
+
+// PathService answers path requests on a pool of worker goroutines, so a slow query doesn't hold up the caller.
+// requests are made with Request and their answers collected with Poll, usually once per tick.
+type PathService struct {
+	mu   sync.Mutex
+	wake *sync.Cond
+	// queue holds the requests no worker has picked up yet, oldest first.
+	queue []*path_job
+	// latest holds the newest request of every ID until it's answered. answers to anything else are dropped.
+	latest  map[int]*path_job
+	done    []PathResponse
+	closed  bool
+	workers sync.WaitGroup
+}
+
+type path_job struct {
+	request PathRequest
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewPathService starts a service with the given number of workers. it must be closed to stop them.
+func NewPathService(workers int) *PathService {
+	s := &PathService{
+		latest: make(map[int]*path_job),
+	}
+	s.wake = sync.NewCond(&s.mu)
+	for range max(workers, 1) {
+		s.workers.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// Request queues r and cancels the previous request with the same ID, whether it's running, queued or answered but
+// not yet polled. if r.Args.Context is set, r is also cancelled along with it.
+func (s *PathService) Request(r PathRequest) {
+	parent := r.Args.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	job := &path_job{r, ctx, cancel}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		cancel()
+		return
+	}
+	s.cancel(r.ID)
+	s.latest[r.ID] = job
+	s.queue = append(s.queue, job)
+	s.wake.Signal()
+}
+
+// Cancel cancels the request with the given ID, if there is one.
+func (s *PathService) Cancel(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel(id)
+}
+
+// cancel must be called with s.mu held.
+func (s *PathService) cancel(id int) {
+	if job, ok := s.latest[id]; ok {
+		job.cancel()
+		delete(s.latest, id)
+	}
+	for i := 0; i < len(s.done); {
+		if s.done[i].ID == id {
+			s.done = append(s.done[:i], s.done[i+1:]...)
+		} else {
+			i++
+		}
+	}
+}
+
+// Pending reports whether the request with the given ID hasn't been answered yet.
+func (s *PathService) Pending(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.latest[id]
+	return ok
+}
+
+// Poll returns the answers that arrived since the last call, without waiting for any.
+func (s *PathService) Poll() []PathResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done := s.done
+	s.done = nil
+	return done
+}
+
+// Close cancels every request and waits for the workers to stop.
+func (s *PathService) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for id := range s.latest {
+		s.cancel(id)
+	}
+	s.queue = nil
+	s.wake.Broadcast()
+	s.mu.Unlock()
+	s.workers.Wait()
+}
+
+func (s *PathService) work() {
+	defer s.workers.Done()
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.wake.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		job := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		var result PathResult
+		if job.ctx.Err() == nil {
+			args := job.request.Args
+			args.Context = job.ctx
+			result = job.request.Search(args)
+		}
+
+		// a request that was cancelled through its own context has no answer, but it isn't pending anymore either.
+		s.mu.Lock()
+		if s.latest[job.request.ID] == job {
+			delete(s.latest, job.request.ID)
+			if job.ctx.Err() == nil {
+				s.done = append(s.done, PathResponse{job.request.ID, job.request.Args, result})
+			}
+		}
+		s.mu.Unlock()
+		job.cancel()
+	}
+}
@@ -0,0 +1,118 @@
+package grid
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// wait_response polls s until it answers, or fails the test.
+func wait_response(t *testing.T, s *PathService) PathResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if responses := s.Poll(); len(responses) > 0 {
+			if len(responses) > 1 {
+				t.Fatalf("%d responses, want 1", len(responses))
+			}
+			return responses[0]
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("no response")
+	return PathResponse{}
+}
+
+func TestPathService(t *testing.T) {
+	s := NewPathService(2)
+	defer s.Close()
+
+	g := parse(
+		"........",
+		"...#....",
+		"...#....",
+		"........",
+	)
+	snapshot := g.Clone()
+	args := PathArgs{Start: Vec2i{0, 1}, Goal: Vec2i{7, 1}, MinSpace: 1}
+	s.Request(PathRequest{ID: 1, Args: args, Search: snapshot.Search})
+	// changing the grid doesn't affect the snapshot being searched.
+	g.SetClosed(3, 0, true)
+
+	response := wait_response(t, s)
+	want, _ := snapshot.FindPath(args)
+	if response.ID != 1 || response.Status != PathFound || !reflect.DeepEqual(response.Path, want) {
+		t.Errorf("response = %+v, want path %v", response, want)
+	}
+	if s.Pending(1) {
+		t.Error("request is still pending after its answer")
+	}
+}
+
+func TestPathServiceReplace(t *testing.T) {
+	s := NewPathService(1)
+	defer s.Close()
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	s.Request(PathRequest{ID: 1, Search: func(arg PathArgs) PathResult {
+		close(started)
+		<-arg.Context.Done()
+		close(cancelled)
+		return PathResult{Path: []Vec2i{{0, 0}}}
+	}})
+	<-started
+
+	s.Request(PathRequest{ID: 1, Args: PathArgs{Goal: Vec2i{1, 1}}, Search: func(arg PathArgs) PathResult {
+		return PathResult{Path: []Vec2i{arg.Goal}}
+	}})
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("older request wasn't cancelled")
+	}
+
+	if response := wait_response(t, s); response.Path[0] != (Vec2i{1, 1}) {
+		t.Errorf("got the answer to the older request")
+	}
+}
+
+func TestPathServiceCancel(t *testing.T) {
+	s := NewPathService(1)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	s.Request(PathRequest{ID: 1, Args: PathArgs{Context: ctx}, Search: func(arg PathArgs) PathResult {
+		<-release
+		return PathResult{Status: PathCancelled}
+	}})
+	cancel()
+	close(release)
+
+	for deadline := time.Now().Add(5 * time.Second); s.Pending(1); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("cancelled request is still pending")
+		}
+	}
+	if responses := s.Poll(); len(responses) != 0 {
+		t.Errorf("cancelled request was answered: %+v", responses)
+	}
+}
+
+func TestFindPathCancelled(t *testing.T) {
+	g := New(256, 256)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	args := PathArgs{Start: Vec2i{0, 0}, Goal: Vec2i{255, 255}, MinSpace: 1, MaxReach: 4, Context: ctx}
+	if path, ok := g.FindPath(args); path != nil || ok {
+		t.Error("A* ignored the cancelled context")
+	}
+	if path, ok := g.FindPathJPS(args); path != nil || ok {
+		t.Error("jump point search ignored the cancelled context")
+	}
+	if path, ok := NewHierarchy(g).FindPath(args); path != nil || ok {
+		t.Error("hierarchy ignored the cancelled context")
+	}
+}
@@ -0,0 +1,62 @@
+package grid
+
+import "fmt"
+
+// TileData is the serialized form of a single tile. ClosedCells holds one bit per cell in row-major order with the
+// first cell in the most significant bit.
+type TileData struct {
+	X           int
+	Y           int
+	ClosedCells uint64
+}
+
+// Tiles packs the closed state of the grid into tiles. cells outside the grid are stored as closed.
+func (g *Grid) Tiles() []TileData {
+	var tiles []TileData
+	for tile_y := 0; tile_y*TileSize < g.height; tile_y++ {
+		for tile_x := 0; tile_x*TileSize < g.width; tile_x++ {
+			grid_x := tile_x * TileSize
+			grid_y := tile_y * TileSize
+			var closed_cells uint64
+			for y0 := 0; y0 < TileSize; y0++ {
+				for x0 := 0; x0 < TileSize; x0++ {
+					closed_cells <<= 1
+					if cell := g.At(grid_x+x0, grid_y+y0); cell == nil || cell.closed {
+						closed_cells |= 1
+					}
+				}
+			}
+			tiles = append(tiles, TileData{
+				X:           tile_x,
+				Y:           tile_y,
+				ClosedCells: closed_cells,
+			})
+		}
+	}
+	return tiles
+}
+
+// SetTiles unpacks tiles produced by Tiles and recomputes the clearance field. tiles that don't fit inside the grid
+// are rejected before anything is modified.
+func (g *Grid) SetTiles(tiles []TileData) error {
+	for _, tile := range tiles {
+		if tile.X < 0 || tile.Y < 0 || tile.X*TileSize >= g.width || tile.Y*TileSize >= g.height {
+			return fmt.Errorf("tile %d,%d is out of bounds", tile.X, tile.Y)
+		}
+	}
+	for _, tile := range tiles {
+		tile_x := tile.X * TileSize
+		tile_y := tile.Y * TileSize
+		closed_cells := tile.ClosedCells
+		for y := TileSize - 1; y >= 0; y-- {
+			for x := TileSize - 1; x >= 0; x-- {
+				if cell := g.At(x+tile_x, y+tile_y); cell != nil {
+					cell.closed = closed_cells&1 == 1
+				}
+				closed_cells >>= 1
+			}
+		}
+	}
+	g.UpdateAll()
+	return nil
+}
@@ -0,0 +1,66 @@
+package grid
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func random_grid(rng *rand.Rand, width, height int, density float64) *Grid {
+	g := New(width, height)
+	for i := range g.cells {
+		g.cells[i].closed = rng.Float64() < density
+	}
+	g.UpdateAll()
+	return g
+}
+
+func TestSaveLoad(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	g := random_grid(rng, 32, 24, 0.3)
+
+	var buf bytes.Buffer
+	if err := g.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := New(32, 24)
+	if _, err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.String(), g.String(); got != want {
+		t.Errorf("loaded grid differs:\n%s\nwant:\n%s", got, want)
+	}
+	for i := range g.cells {
+		if g.cells[i].space != loaded.cells[i].space {
+			t.Fatalf("space differs at cell %d", i)
+		}
+	}
+}
+
+func TestSetTilesRejectsOutOfBounds(t *testing.T) {
+	g := New(16, 16)
+	err := g.SetTiles([]TileData{
+		{X: 0, Y: 0, ClosedCells: ^uint64(0)},
+		{X: 2, Y: 0, ClosedCells: ^uint64(0)},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if g.At(0, 0).Closed() {
+		t.Error("grid was modified by a rejected load")
+	}
+}
+
+func TestTileBitOrder(t *testing.T) {
+	g := New(8, 8)
+	g.SetClosed(0, 0, true)
+	g.SetClosed(7, 7, true)
+	tiles := g.Tiles()
+	if len(tiles) != 1 {
+		t.Fatalf("got %d tiles, want 1", len(tiles))
+	}
+	if want := uint64(1<<63 | 1); tiles[0].ClosedCells != want {
+		t.Errorf("closed cells = %064b, want %064b", tiles[0].ClosedCells, want)
+	}
+}
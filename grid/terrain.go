@@ -0,0 +1,85 @@
+package grid
+
+import "image"
+
+// Terrain is what an open cell is covered with, which decides how much it costs to move through. it doesn't affect
+// clearance, and closed cells keep theirs for when they're opened again.
+type Terrain uint8
+
+const (
+	// TerrainRoad is the terrain of a new grid and the cheapest one to move through.
+	TerrainRoad Terrain = iota
+	TerrainGrass
+	TerrainMud
+	TerrainWater
+	TerrainCount
+)
+
+// terrain_costs are never below 1, so octile never overestimates the cost of a path.
+var terrain_costs = [TerrainCount]float64{
+	TerrainRoad:  1,
+	TerrainGrass: 1.5,
+	TerrainMud:   2.5,
+	TerrainWater: 4,
+}
+
+// Cost is how many times as much moving through the terrain costs as moving along a road.
+func (t Terrain) Cost() float64 {
+	return terrain_costs[t]
+}
+
+func (t Terrain) String() string {
+	switch t {
+	case TerrainRoad:
+		return "road"
+	case TerrainGrass:
+		return "grass"
+	case TerrainMud:
+		return "mud"
+	case TerrainWater:
+		return "water"
+	default:
+		return "?"
+	}
+}
+
+func (c Cell) Terrain() Terrain {
+	return c.terrain
+}
+
+// travel_cost is the cost of a step from a to b, which are next to each other. each cell pays for half of the step
+// through its terrain, so steps cost the same both ways.
+func (g *Grid) travel_cost(a, b Vec2i) float64 {
+	return octile(a, b) * (g.AtPos(a).terrain.Cost() + g.AtPos(b).terrain.Cost()) / 2
+}
+
+// SetTerrain changes the terrain of a cell. it returns the cell's bounds when the terrain changed, and is empty when it
+// didn't.
+func (g *Grid) SetTerrain(x, y int, terrain Terrain) image.Rectangle {
+	cell := g.At(x, y)
+	if cell == nil || cell.terrain == terrain {
+		return image.Rectangle{}
+	}
+	cell.terrain = terrain
+	g.clear_caches()
+	return image.Rect(x, y, x+1, y+1)
+}
+
+// FillTerrain sets every cell to the same terrain.
+func (g *Grid) FillTerrain(terrain Terrain) {
+	g.clear_caches()
+	for i := range g.cells {
+		g.cells[i].terrain = terrain
+	}
+}
+
+// uniform_terrain reports whether every cell is a road, in which case every step costs as much as it does on an empty
+// grid.
+func (g *Grid) uniform_terrain() bool {
+	for i := range g.cells {
+		if g.cells[i].terrain != TerrainRoad {
+			return false
+		}
+	}
+	return true
+}
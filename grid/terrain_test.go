@@ -0,0 +1,66 @@
+package grid
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// terrain_cost sums what every step along path costs through the terrain of g.
+func terrain_cost(g *Grid, path []Vec2i) (cost float64) {
+	for i := 1; i < len(path); i++ {
+		cost += g.travel_cost(path[i-1], path[i])
+	}
+	return
+}
+
+func TestFindPathAvoidsMud(t *testing.T) {
+	g := New(12, 7)
+	// a band of mud across the middle, with a road around it.
+	for y := 1; y < 6; y++ {
+		for x := 3; x < 9; x++ {
+			g.SetTerrain(x, y, TerrainMud)
+		}
+	}
+	path, ok := g.FindPath(PathArgs{Start: Vec2i{0, 3}, Goal: Vec2i{11, 3}, MinSpace: 1})
+	if !ok {
+		t.Fatal("no path")
+	}
+	check_path(t, g, path, 1)
+	for _, p := range path {
+		if g.AtPos(p).Terrain() == TerrainMud {
+			t.Fatalf("path goes through the mud at %v: %v", p, path)
+		}
+	}
+}
+
+func TestTerrainSearchesAgree(t *testing.T) {
+	rng := rand.New(rand.NewSource(20))
+	for i := 0; i < 50; i++ {
+		g := random_grid(rng, 24, 24, 0.15)
+		for j := 0; j < 200; j++ {
+			g.SetTerrain(rng.Intn(24), rng.Intn(24), Terrain(rng.Intn(int(TerrainCount))))
+		}
+		start := Vec2i{rng.Intn(24), rng.Intn(24)}
+		goal := Vec2i{rng.Intn(24), rng.Intn(24)}
+		g.SetClosed(start.X, start.Y, false)
+		g.SetClosed(goal.X, goal.Y, false)
+		args := PathArgs{Start: start, Goal: goal, MinSpace: 1}
+
+		path, ok := g.FindPath(args)
+		costs := g.costs_within(goal, 1, g.Bounds(), nil)
+		want := costs[start.X+(start.Y*24)]
+		if ok != !math.IsInf(want, 1) {
+			t.Fatalf("map %d: found = %v, cost to goal %f\n%s", i, ok, want, g)
+		}
+		if !ok {
+			continue
+		}
+		if got := terrain_cost(g, path); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("map %d: path costs %f, want %f", i, got, want)
+		}
+		if jps, _ := g.FindPathJPS(args); math.Abs(terrain_cost(g, jps)-want) > 1e-9 {
+			t.Fatalf("map %d: jump point search path costs %f, want %f", i, terrain_cost(g, jps), want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package grid
+
+import (
+	"image"
+	"math"
+)
+
+type Vec2i struct {
+	X int
+	Y int
+}
+
+func (p Vec2i) Add(other Vec2i) Vec2i {
+	return p.Add2(other.X, other.Y)
+}
+
+func (p Vec2i) Add2(x, y int) Vec2i {
+	return Vec2i{
+		p.X + x,
+		p.Y + y,
+	}
+}
+
+func (p Vec2i) DistanceSq(other Vec2i) int {
+	dx := other.X - p.X
+	dy := other.Y - p.Y
+	return dx*dx + dy*dy
+}
+
+func (p Vec2i) Distance(other Vec2i) int {
+	return sqrt_int(p.DistanceSq(other))
+}
+
+func sqrt_int(x int) int {
+	return int(math.Round(math.Sqrt(float64(x))))
+}
+
+func (p Vec2i) in(r image.Rectangle) bool {
+	return p.X >= r.Min.X && p.Y >= r.Min.Y && p.X < r.Max.X && p.Y < r.Max.Y
+}
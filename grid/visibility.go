@@ -0,0 +1,102 @@
+package grid
+
+// blocks_sight reports whether p can't be seen through. everything outside the grid blocks sight.
+func (g *Grid) blocks_sight(p Vec2i) bool {
+	c := g.AtPos(p)
+	return c == nil || c.closed
+}
+
+// CanSee reports whether the center of b can be seen from the center of a. only closed cells block sight, and the
+// cells at either end don't count, so walls can be seen. a line passing exactly between two diagonal closed cells is
+// blocked, like it is in FieldOfView.
+func (g *Grid) CanSee(a, b Vec2i) bool {
+	prev := a
+	return supercover(a, b, false, func(p Vec2i) bool {
+		if p != a && p != b && g.blocks_sight(p) {
+			return false
+		}
+		// without corners the walk only moves diagonally when it passes exactly through a corner.
+		if p.X != prev.X && p.Y != prev.Y && g.blocks_sight(Vec2i{p.X, prev.Y}) && g.blocks_sight(Vec2i{prev.X, p.Y}) {
+			return false
+		}
+		prev = p
+		return true
+	})
+}
+
+// octants transforms the first octant into each of the eight, as xx, xy, yx, yy.
+var octants = [8][4]int{
+	{1, 0, 0, 1},
+	{0, 1, 1, 0},
+	{0, -1, 1, 0},
+	{-1, 0, 0, 1},
+	{-1, 0, 0, -1},
+	{0, -1, -1, 0},
+	{0, 1, -1, 0},
+	{1, 0, 0, -1},
+}
+
+// FieldOfView returns every cell that can be seen from origin within radius, with recursive shadowcasting. closed
+// cells block sight but are seen themselves, so the walls around a room are part of its field of view.
+func (g *Grid) FieldOfView(origin Vec2i, radius int) []Vec2i {
+	if !g.InBounds(origin.X, origin.Y) {
+		return nil
+	}
+	seen := make([]bool, len(g.cells))
+	visible := []Vec2i{origin}
+	seen[origin.X+(origin.Y*g.width)] = true
+	light := func(p Vec2i) {
+		if i := p.X + (p.Y * g.width); g.InBounds(p.X, p.Y) && !seen[i] {
+			seen[i] = true
+			visible = append(visible, p)
+		}
+	}
+	for _, octant := range octants {
+		g.cast_light(origin, radius, 1, 1, 0, octant, light)
+	}
+	return visible
+}
+
+// cast_light scans one octant row by row outwards from origin, starting at row. start and end are the slopes of the
+// light that is still unblocked. every closed cell in a row narrows the light for the rows beyond it, and the light
+// between two runs of closed cells is scanned recursively.
+func (g *Grid) cast_light(origin Vec2i, radius, row int, start, end float64, octant [4]int, light func(Vec2i)) {
+	if start < end {
+		return
+	}
+	xx, xy, yx, yy := octant[0], octant[1], octant[2], octant[3]
+	var next_start float64
+	for j := row; j <= radius; j++ {
+		blocked := false
+		for dx, dy := -j, -j; dx <= 0; dx++ {
+			p := Vec2i{origin.X + dx*xx + dy*xy, origin.Y + dx*yx + dy*yy}
+			left := (float64(dx) - 0.5) / (float64(dy) + 0.5)
+			right := (float64(dx) + 0.5) / (float64(dy) - 0.5)
+			if start < right {
+				continue
+			} else if end > left {
+				break
+			}
+
+			if dx*dx+dy*dy <= radius*radius {
+				light(p)
+			}
+
+			if blocked {
+				if g.blocks_sight(p) {
+					next_start = right
+					continue
+				}
+				blocked = false
+				start = next_start
+			} else if g.blocks_sight(p) && j < radius {
+				blocked = true
+				g.cast_light(origin, radius, j+1, start, left, octant, light)
+				next_start = right
+			}
+		}
+		if blocked {
+			break
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package grid
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestCanSee(t *testing.T) {
+	g := parse(
+		"......",
+		"..#...",
+		"......",
+		"#.....",
+		".#....",
+	)
+	tests := []struct {
+		a, b Vec2i
+		want bool
+	}{
+		{Vec2i{0, 0}, Vec2i{5, 0}, true},
+		{Vec2i{0, 1}, Vec2i{5, 1}, false},
+		// walls can be seen.
+		{Vec2i{0, 1}, Vec2i{2, 1}, true},
+		// grazing the corner of a single closed cell.
+		{Vec2i{1, 2}, Vec2i{4, 1}, true},
+		// exactly between two diagonal closed cells.
+		{Vec2i{0, 4}, Vec2i{2, 2}, false},
+		{Vec2i{4, 4}, Vec2i{4, 4}, true},
+	}
+	for _, test := range tests {
+		if got := g.CanSee(test.a, test.b); got != test.want {
+			t.Errorf("can see from %v to %v = %v, want %v", test.a, test.b, got, test.want)
+		}
+		if got := g.CanSee(test.b, test.a); got != test.want {
+			t.Errorf("can see from %v to %v = %v, want %v", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestFieldOfViewOpen(t *testing.T) {
+	g := New(15, 15)
+	origin := Vec2i{7, 7}
+	visible := g.FieldOfView(origin, 4)
+	for y := 0; y < 15; y++ {
+		for x := 0; x < 15; x++ {
+			p := Vec2i{x, y}
+			want := p.DistanceSq(origin) <= 16
+			if got := slices.Contains(visible, p); got != want {
+				t.Errorf("%v visible = %v, want %v", p, got, want)
+			}
+		}
+	}
+	seen := map[Vec2i]bool{}
+	for _, p := range visible {
+		if seen[p] {
+			t.Errorf("%v is visible more than once", p)
+		}
+		seen[p] = true
+	}
+}
+
+func TestFieldOfViewShadow(t *testing.T) {
+	g := parse(
+		".......",
+		".......",
+		"...#...",
+		".......",
+		".......",
+	)
+	visible := g.FieldOfView(Vec2i{3, 4}, 10)
+	for _, p := range []Vec2i{{3, 2}, {0, 0}, {6, 0}, {2, 1}} {
+		if !slices.Contains(visible, p) {
+			t.Errorf("%v isn't visible", p)
+		}
+	}
+	for _, p := range []Vec2i{{3, 1}, {3, 0}} {
+		if slices.Contains(visible, p) {
+			t.Errorf("%v is visible behind the wall", p)
+		}
+	}
+}
+
+func TestFieldOfViewStaysInside(t *testing.T) {
+	rng := rand.New(rand.NewSource(15))
+	for i := 0; i < 50; i++ {
+		g := random_grid(rng, 32, 32, 0.1)
+		// a closed room with random walls inside.
+		room := Vec2i{8 + rng.Intn(8), 8 + rng.Intn(8)}
+		size := 4 + rng.Intn(8)
+		for y := room.Y - 1; y <= room.Y+size; y++ {
+			for x := room.X - 1; x <= room.X+size; x++ {
+				if x == room.X-1 || y == room.Y-1 || x == room.X+size || y == room.Y+size {
+					g.SetClosed(x, y, true)
+				}
+			}
+		}
+		origin := Vec2i{room.X + rng.Intn(size), room.Y + rng.Intn(size)}
+		for _, p := range g.FieldOfView(origin, 64) {
+			if p.X < room.X-1 || p.Y < room.Y-1 || p.X > room.X+size || p.Y > room.Y+size {
+				t.Fatalf("map %d: %v is visible from %v outside the room\n%s", i, p, origin, g)
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package grid
+
+import (
+	"image"
+)
+
+const (
+	// chunk_size is the width and height of a chunk in cells.
+	chunk_size = tile_count * TileSize
+	// tile_count is the width and height of a chunk in tiles.
+	tile_count = 8
+)
+
+// World is a sparse grid without bounds. cells are stored in tiles, and tiles in chunks that are keyed by their
+// position, so the world can grow in any direction. cells that are open and at least max_space away from any closed
+// cell aren't stored at all, and neither are the tiles and chunks made up only of them.
+//
+// unlike Grid, nothing outside of the world counts as closed, so clearance is capped at max_space to keep it finite.
+type World struct {
+	chunks    map[Vec2i]*chunk
+	max_space int
+}
+
+// NewWorld returns an empty world where clearance is capped at max_space.
+func NewWorld(max_space int) *World {
+	return &World{
+		chunks:    make(map[Vec2i]*chunk),
+		max_space: max_space,
+	}
+}
+
+func (w *World) MaxSpace() int {
+	return w.max_space
+}
+
+func floor_div(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// locate splits a cell position into the key of its chunk, the index of its tile within the chunk and the index of the
+// cell within the tile.
+func locate(x, y int) (key Vec2i, tile_index, cell_index int) {
+	key = Vec2i{floor_div(x, chunk_size), floor_div(y, chunk_size)}
+	local_x, local_y := x-key.X*chunk_size, y-key.Y*chunk_size
+	tile_index = local_x/TileSize + (local_y/TileSize)*tile_count
+	cell_index = local_x%TileSize + (local_y%TileSize)*TileSize
+	return
+}
+
+func (w *World) empty_cell() Cell {
+	return Cell{space: w.max_space}
+}
+
+// At returns the cell at x, y. cells that aren't stored are open with max_space clearance.
+func (w *World) At(x, y int) Cell {
+	key, tile_index, cell_index := locate(x, y)
+	if c := w.chunks[key]; c != nil {
+		if t := c.tiles[tile_index]; t.cells != nil {
+			return t.cells[cell_index]
+		}
+	}
+	return w.empty_cell()
+}
+
+func (w *World) AtPos(p Vec2i) Cell {
+	return w.At(p.X, p.Y)
+}
+
+// set stores a cell, allocating its tile and chunk when the cell isn't empty.
+func (w *World) set(x, y int, cell Cell) {
+	key, tile_index, cell_index := locate(x, y)
+	c := w.chunks[key]
+	if c == nil {
+		if cell == w.empty_cell() {
+			return
+		}
+		c = &chunk{tiles: new([tile_count * tile_count]tile)}
+		w.chunks[key] = c
+	}
+	t := &c.tiles[tile_index]
+	if t.cells == nil {
+		if cell == w.empty_cell() {
+			return
+		}
+		t.cells = new([TileSize * TileSize]Cell)
+		for i := range t.cells {
+			t.cells[i] = w.empty_cell()
+		}
+	}
+	t.cells[cell_index] = cell
+}
+
+// compact releases the tiles within r that only hold empty cells, and the chunks left without any tiles.
+func (w *World) compact(r image.Rectangle) {
+	for key_y := floor_div(r.Min.Y, chunk_size); key_y <= floor_div(r.Max.Y-1, chunk_size); key_y++ {
+		for key_x := floor_div(r.Min.X, chunk_size); key_x <= floor_div(r.Max.X-1, chunk_size); key_x++ {
+			key := Vec2i{key_x, key_y}
+			c := w.chunks[key]
+			if c == nil {
+				continue
+			}
+			used := false
+			for i := range c.tiles {
+				t := &c.tiles[i]
+				if t.cells == nil {
+					continue
+				}
+				empty := true
+				for _, cell := range t.cells {
+					if cell != w.empty_cell() {
+						empty = false
+						break
+					}
+				}
+				if empty {
+					t.cells = nil
+				} else {
+					used = true
+				}
+			}
+			if !used {
+				delete(w.chunks, key)
+			}
+		}
+	}
+}
+
+// ChunkCount returns how many chunks are stored.
+func (w *World) ChunkCount() int {
+	return len(w.chunks)
+}
+
+// Bounds returns the rectangle covering every stored chunk. everything outside of it is open.
+func (w *World) Bounds() (r image.Rectangle) {
+	for key := range w.chunks {
+		r = r.Union(image.Rect(key.X*chunk_size, key.Y*chunk_size, (key.X+1)*chunk_size, (key.Y+1)*chunk_size))
+	}
+	return
+}
+
+// SetClosed changes the closed state of a cell and updates the clearance of the cells around it. only the cells within
+// max_space of x, y can change, and their clearance depends only on the cells within max_space of them, so a distance
+// transform over that neighbourhood is exact. it returns the bounds of every cell whose space changed.
+func (w *World) SetClosed(x, y int, closed bool) (dirty image.Rectangle) {
+	cell := w.At(x, y)
+	if cell.closed == closed {
+		return
+	}
+	cell.closed = closed
+	w.set(x, y, cell)
+
+	reach := w.max_space + 1
+	window := image.Rect(x-reach, y-reach, x+reach+1, y+reach+1)
+	region := window.Inset(-reach)
+	width, height := region.Dx(), region.Dy()
+
+	n := max(width, height)
+	f := make([]int, n)
+	d := make([]int, n)
+	s := make([]int, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+	columns := make([]int, width*height)
+
+	for column := 0; column < width; column++ {
+		for row := 0; row < height; row++ {
+			if w.At(region.Min.X+column, region.Min.Y+row).closed {
+				f[row] = 0
+			} else {
+				f[row] = distance_infinity
+			}
+		}
+		distance_transform(f[:height], d, s, v, z)
+		for row := 0; row < height; row++ {
+			columns[column+(row*width)] = d[row]
+		}
+	}
+
+	for row := reach; row < height-reach; row++ {
+		copy(f, columns[row*width:(row+1)*width])
+		distance_transform(f[:width], d, s, v, z)
+		for column := reach; column < width-reach; column++ {
+			p := Vec2i{region.Min.X + column, region.Min.Y + row}
+			cell := w.AtPos(p)
+			if space := min(sqrt_int(d[column]), w.max_space); space != cell.space {
+				cell.space = space
+				w.set(p.X, p.Y, cell)
+				dirty = dirty.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+			}
+		}
+	}
+
+	w.compact(window)
+	return
+}
+
+func (w *World) traversable(p Vec2i, min_space int) bool {
+	cell := w.AtPos(p)
+	return !cell.closed && cell.space >= min_space
+}
+
+func (w *World) can_step(p Vec2i, dir Direction, min_space int) bool {
+	if dir.Diagonal() {
+		if !w.traversable(p.Add(dir.RotateCW().Vec2i()), min_space) {
+			return false
+		} else if !w.traversable(p.Add(dir.RotateCCW().Vec2i()), min_space) {
+			return false
+		}
+	}
+	return w.traversable(p.Add(dir.Vec2i()), min_space)
+}
+
+// FindPath searches for the cheapest path from arg.Start to arg.Goal with A*, the same way Grid.FindPath does. paths
+// never need to stray further than a cell outside of the stored chunks, since everything out there is open, so that's
+// where the search stops. cells are numbered as they're discovered, which keeps the search state in flat slices no
+// matter how far apart the chunks are.
+func (w *World) FindPath(arg PathArgs) ([]Vec2i, bool) {
+	result := w.Search(arg)
+	return result.Path, result.Status == PathFound
+}
+
+// Search is FindPath, but it also says why the search ended and how much work it took.
+func (w *World) Search(arg PathArgs) PathResult {
+	bounds := w.Bounds().
+		Union(image.Rect(arg.Start.X, arg.Start.Y, arg.Start.X+1, arg.Start.Y+1)).
+		Union(image.Rect(arg.Goal.X, arg.Goal.Y, arg.Goal.X+1, arg.Goal.Y+1)).
+		Inset(-1)
+	return astar(arg, world_nodes{w, bounds, make(map[Vec2i]int), new([]Vec2i)})
+}
+
+// world_nodes numbers the cells of a world within bounds in the order they're discovered.
+type world_nodes struct {
+	w         *World
+	bounds    image.Rectangle
+	ids       map[Vec2i]int
+	positions *[]Vec2i
+}
+
+func (n world_nodes) size() int {
+	return 0
+}
+
+func (n world_nodes) id(p Vec2i) int {
+	i, ok := n.ids[p]
+	if !ok {
+		i = len(*n.positions)
+		n.ids[p] = i
+		*n.positions = append(*n.positions, p)
+	}
+	return i
+}
+
+func (n world_nodes) pos(id int) Vec2i {
+	return (*n.positions)[id]
+}
+
+func (n world_nodes) step(arg *PathArgs, p Vec2i, dir Direction) (int, float64, bool) {
+	next := p.Add(dir.Vec2i())
+	if !next.in(n.bounds) || !n.w.can_step(p, dir, arg.MinSpace) {
+		return 0, 0, false
+	}
+	return n.id(next), arg.step_cost(dir, n.w.AtPos(p), n.w.AtPos(next)), true
+}
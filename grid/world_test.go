@@ -0,0 +1,112 @@
+package grid
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// world_space is the clearance of x, y in w measured by brute force over the closed cells in closed.
+func world_space(w *World, closed map[Vec2i]bool, p Vec2i) int {
+	if closed[p] {
+		return 0
+	}
+	space := w.MaxSpace()
+	for q := range closed {
+		space = min(space, sqrt_int(p.DistanceSq(q)))
+	}
+	return space
+}
+
+func TestWorldSpaceAcrossChunks(t *testing.T) {
+	rng := rand.New(rand.NewSource(13))
+	w := NewWorld(6)
+	closed := make(map[Vec2i]bool)
+	// straddle the four chunks around the origin.
+	for i := 0; i < 300; i++ {
+		p := Vec2i{rng.Intn(40) - 20, rng.Intn(40) - 20}
+		if closed[p] {
+			delete(closed, p)
+			w.SetClosed(p.X, p.Y, false)
+		} else {
+			closed[p] = true
+			w.SetClosed(p.X, p.Y, true)
+		}
+	}
+	for y := -30; y < 30; y++ {
+		for x := -30; x < 30; x++ {
+			p := Vec2i{x, y}
+			if got, want := w.AtPos(p).Space(), world_space(w, closed, p); got != want {
+				t.Fatalf("space at %v = %d, want %d", p, got, want)
+			}
+			if got := w.AtPos(p).Closed(); got != closed[p] {
+				t.Fatalf("closed at %v = %v, want %v", p, got, closed[p])
+			}
+		}
+	}
+}
+
+func TestWorldReleasesEmptyChunks(t *testing.T) {
+	w := NewWorld(15)
+	if w.ChunkCount() != 0 {
+		t.Fatalf("new world has %d chunks", w.ChunkCount())
+	}
+	w.SetClosed(1000, -1000, true)
+	w.SetClosed(-5, -5, true)
+	if w.ChunkCount() == 0 {
+		t.Fatal("closed cells aren't stored")
+	}
+	w.SetClosed(1000, -1000, false)
+	w.SetClosed(-5, -5, false)
+	if w.ChunkCount() != 0 {
+		t.Errorf("%d chunks are left in an empty world", w.ChunkCount())
+	}
+}
+
+func TestWorldFindPath(t *testing.T) {
+	w := NewWorld(4)
+	// a wall along the chunk border at x = 0, with a gap far below the origin.
+	for y := -100; y <= 100; y++ {
+		if y != 90 {
+			w.SetClosed(0, y, true)
+		}
+	}
+	args := PathArgs{Start: Vec2i{-10, 0}, Goal: Vec2i{10, 0}, MinSpace: 1}
+	path, ok := w.FindPath(args)
+	if !ok {
+		t.Fatal("no path")
+	}
+	for i, p := range path {
+		if !w.traversable(p, 1) && i > 0 {
+			t.Fatalf("path enters blocked cell %v", p)
+		}
+	}
+	if !slices.Contains(path, Vec2i{0, 90}) {
+		t.Errorf("path didn't go through the gap")
+	}
+
+	// agents too large for the gap walk around the ends of the wall instead.
+	args.MinSpace = 2
+	if path, ok := w.FindPath(args); !ok {
+		t.Error("no path around the wall")
+	} else if slices.Contains(path, Vec2i{0, 90}) || len(path) < 200 {
+		t.Errorf("path of length %d didn't go around the wall", len(path))
+	}
+}
+
+func TestWorldFindPathEnclosed(t *testing.T) {
+	w := NewWorld(4)
+	for i := -3; i <= 3; i++ {
+		w.SetClosed(i, -3, true)
+		w.SetClosed(i, 3, true)
+		w.SetClosed(-3, i, true)
+		w.SetClosed(3, i, true)
+	}
+	if _, ok := w.FindPath(PathArgs{Start: Vec2i{-50, -50}, Goal: Vec2i{0, 0}, MinSpace: 1}); ok {
+		t.Fatal("reached an enclosed goal")
+	}
+	path, ok := w.FindPath(PathArgs{Start: Vec2i{-50, -50}, Goal: Vec2i{0, 0}, MinSpace: 1, MaxReach: 6})
+	if ok || len(path) == 0 {
+		t.Fatalf("path = %v, %v, want a partial path", path, ok)
+	}
+}